@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 
 	"github.com/egginabucket/openmsr/pkg/libmsr"
@@ -45,6 +46,10 @@ func main() {
 	}
 	fmt.Println("MSR Model:", s)
 
+	fmt.Println("DIAGNOSE ...")
+	report := d.Diagnose(context.Background(), false)
+	fmt.Println(report)
+
 	err = d.SetHiCo()
 	if err != nil {
 		panic(err)
@@ -64,14 +69,14 @@ func main() {
 		panic(err)
 	}
 	fmt.Println("Raw data:", t[0], t[1], t[2])
-	b, p, lrcOK = libmsr.DecodeRaw(t[0], ' ', 7, 8, false)
+	b, p, lrcOK = libmsr.DecodeTrack(t[0], libmsr.ISOTrack1)
 	fmt.Println("Track 1", string(b))
 	fmt.Println(p)
 	fmt.Println(lrcOK)
-	b, p, _ = libmsr.DecodeRaw(t[1], '0', 5, 8, false)
+	b, p, _ = libmsr.DecodeTrack(t[1], libmsr.ISOTrack2)
 	fmt.Println(p)
 	fmt.Println("Track 2", string(b))
-	b, _, _ = libmsr.DecodeRaw(t[2], '0', 5, 8, false)
+	b, _, _ = libmsr.DecodeTrack(t[2], libmsr.ISOTrack3)
 	fmt.Println("Track 3", string(b))
 	/*
 		b, err = d.ReadISOTracks()
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/egginabucket/openmsr/pkg/libmsr"
+	"github.com/egginabucket/openmsr/pkg/wsbridge"
+	"github.com/karalabe/usb"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:8605", "listen address")
+	origins := flag.String("origins", "", "comma-separated allowed origins")
+	flag.Parse()
+
+	hids, err := usb.EnumerateHid(libmsr.VendorID, libmsr.ProductID)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(hids) < 1 {
+		log.Fatal("no device found")
+	}
+	dev, err := hids[0].Open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	d := libmsr.NewDevice(dev)
+	defer d.Close()
+	if err = d.Reset(); err != nil {
+		log.Fatal(err)
+	}
+
+	var allowed []string
+	for _, o := range strings.Split(*origins, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			allowed = append(allowed, o)
+		}
+	}
+	s := wsbridge.NewServer(d, allowed...)
+	defer s.Close()
+	log.Println("listening on", *addr)
+	log.Println(http.ListenAndServe(*addr, s))
+}
@@ -1,7 +1,9 @@
 package gui
 
 import (
-	"sync"
+	"context"
+	"errors"
+	"fmt"
 
 	"github.com/andlabs/ui"
 	"github.com/egginabucket/openmsr/pkg/libmsr"
@@ -17,6 +19,7 @@ const (
 const (
 	infoIEC7813 = iota
 	infoAAMVA
+	infoAuto
 )
 
 const (
@@ -27,6 +30,8 @@ const (
 
 type App struct {
 	device         *libmsr.Device
+	resilient      *libmsr.ResilientDevice
+	queue          *libmsr.Queue
 	win            *ui.Window
 	deviceCB       *ui.Combobox
 	refreshButton  *ui.Button
@@ -35,6 +40,7 @@ type App struct {
 	presetRadio    *ui.RadioButtons
 	coRadio        *ui.RadioButtons
 	infoTypeCB     *ui.Combobox
+	detectCB       *ui.Checkbox
 	showInfoButton *ui.Button
 	tracks         [3]*Track
 	resetButton,
@@ -44,7 +50,6 @@ type App struct {
 	openButton,
 	saveButton *ui.Button
 	progBar *ui.ProgressBar
-	mu      sync.Mutex
 }
 
 func enableDisable(m bool) func(ui.Control) {
@@ -55,11 +60,13 @@ func enableDisable(m bool) func(ui.Control) {
 	}
 }
 
+// throwErr shows err from any goroutine.
 func (a *App) throwErr(err error) {
-	if err == usb.ErrDeviceClosed {
+	if errors.Is(err, usb.ErrDeviceClosed) || errors.Is(err, libmsr.ErrClosed) ||
+		errors.Is(err, libmsr.ErrJobCancelled) {
 
 	} else {
-		ui.MsgBoxError(a.win, "Error", err.Error())
+		ui.QueueMain(func() { ui.MsgBoxError(a.win, "Error", err.Error()) })
 	}
 }
 
@@ -113,32 +120,75 @@ func (a *App) selectDevice(cb *ui.Combobox) {
 	if cb.Selected() == 0 {
 		return // already disconnected
 	}
-	d, err := a.availableDevs[cb.Selected()-1].Open()
+	info := a.availableDevs[cb.Selected()-1]
+	d, err := info.Open()
 	if err != nil {
 		cb.SetSelected(0)
 		a.throwErr(err)
 		return
 	}
-	a.connect(d)
+	a.connect(*info, d)
 }
 
-func (a *App) connect(d usb.Device) {
-	a.mu.Lock()
+// reopen finds a device again by its serial number or path.
+func reopen(info usb.DeviceInfo) func() (libmsr.Transport, error) {
+	return func() (libmsr.Transport, error) {
+		hids, err := usb.EnumerateHid(info.VendorID, info.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		for _, di := range hids {
+			if info.Serial != "" && di.Serial == info.Serial ||
+				info.Serial == "" && di.Path == info.Path {
+				return di.Open()
+			}
+		}
+		return nil, errors.New("device not found")
+	}
+}
+
+func (a *App) onConnEvent(e libmsr.ReconnectEvent) {
+	ui.QueueMain(func() {
+		switch e.Event {
+		case libmsr.Disconnected:
+			a.win.SetTitle("OpenMSR (reconnecting...)")
+		case libmsr.Reconnected:
+			a.win.SetTitle("OpenMSR")
+		case libmsr.GaveUp:
+			a.win.SetTitle("OpenMSR (disconnected)")
+		}
+	})
+}
+
+func (a *App) connect(info usb.DeviceInfo, d usb.Device) {
 	defer a.reset(nil)
-	defer a.mu.Unlock()
 	a.setDeviceAble(true)
 	a.device = libmsr.NewDevice(d)
+	a.resilient = libmsr.NewResilientDevice(a.device, reopen(info))
+	a.resilient.OnEvent = a.onConnEvent
+	a.queue = a.resilient.NewQueue()
+}
+
+// closeDevice closes the queue and device without blocking the UI thread.
+func (a *App) closeDevice() {
+	q, r := a.queue, a.resilient
+	q.Close()
+	go func() {
+		q.Wait()
+		if err := r.Close(); err != nil {
+			a.throwErr(err)
+		}
+	}()
 }
 
 func (a *App) disconnect() {
-	a.mu.Lock()
-	defer a.mu.Unlock()
 	a.deviceCB.SetSelected(connNone)
 	a.setDeviceAble(false)
-	if err := a.device.Close(); err != nil {
-		a.throwErr(err)
-	}
+	a.closeDevice()
+	a.win.SetTitle("OpenMSR")
 	a.device = nil
+	a.resilient = nil
+	a.queue = nil
 }
 
 func (a *App) controls() []ui.Control {
@@ -159,7 +209,6 @@ func (a *App) setFrozen(f bool) {
 }
 
 func (a *App) freeze() {
-	a.mu.Lock()
 	a.progBar.Show()
 	a.setFrozen(true)
 }
@@ -167,12 +216,14 @@ func (a *App) freeze() {
 func (a *App) unfreeze() {
 	a.setFrozen(false)
 	a.progBar.Hide()
-	a.mu.Unlock()
+}
+
+// do runs j on the device queue and waits for it.
+func (a *App) do(j libmsr.Job) error {
+	return a.queue.Submit(j).Wait(context.Background())
 }
 
 func (a *App) selectPreset(r *ui.RadioButtons) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
 	preset := Preset(r.Selected())
 	switch preset {
 	case PresetAAMVA:
@@ -191,35 +242,44 @@ func (a *App) setDefaults() {
 	a.infoTypeCB.SetSelected(infoIEC7813)
 }
 
+// reset resets the device without blocking the UI thread.
 func (a *App) reset(*ui.Button) {
-	a.mu.Lock()
-	defer a.setDefaults()
-	defer a.mu.Unlock()
-	if err := a.device.Reset(); err != nil {
-		a.throwErr(err)
-	}
-	isHiCo, err := a.device.IsHiCo()
-	if err != nil {
-		a.throwErr(err)
-	} else {
-		if isHiCo {
-			a.coRadio.SetSelected(hiCo)
-		} else {
-			a.coRadio.SetSelected(loCo)
+	a.setDefaults()
+	var isHiCo bool
+	h := a.queue.Submit(libmsr.JobFunc(func(d *libmsr.Device) (err error) {
+		if err = d.Reset(); err == nil {
+			isHiCo, err = d.IsHiCo()
 		}
-	}
+		return
+	}))
+	go func() {
+		if err := h.Wait(context.Background()); err != nil {
+			a.throwErr(err)
+			return
+		}
+		ui.QueueMain(func() {
+			if isHiCo {
+				a.coRadio.SetSelected(hiCo)
+			} else {
+				a.coRadio.SetSelected(loCo)
+			}
+		})
+	}()
 }
 
 func (a *App) read() {
 	a.freeze()
 	defer a.unfreeze()
-	rawTracks, err := a.device.ReadRawTracks()
-	if err != nil {
+	var job libmsr.ReadJob
+	if err := a.do(&job); err != nil {
 		a.throwErr(err)
 		return
 	}
 	for i, t := range a.tracks {
-		chars, _, _ := t.decode(rawTracks[i])
+		if a.detectCB.Checked() {
+			t.detectFormat(job.Tracks[i])
+		}
+		chars, _, _ := t.decode(job.Tracks[i])
 		t.edit.SetText(string(chars))
 	}
 }
@@ -227,14 +287,13 @@ func (a *App) read() {
 func (a *App) write() {
 	a.freeze()
 	defer a.unfreeze()
-	var tracks [3][]byte
+	var job libmsr.WriteJob
 	for i, track := range a.tracks {
 		if !track.disabled {
-			tracks[i] = []byte(track.edit.Text())
+			job.Tracks[i] = []byte(track.edit.Text())
 		}
 	}
-	err := a.device.WriteISOTracks(tracks[0], tracks[1], tracks[2])
-	if err != nil {
+	if err := a.do(&job); err != nil {
 		a.throwErr(err)
 	}
 }
@@ -242,16 +301,19 @@ func (a *App) write() {
 func (a *App) writeRaw() {
 	a.freeze()
 	defer a.unfreeze()
-	var rawTracks [3][]byte
+	job := libmsr.WriteJob{Raw: true}
 	for i, track := range a.tracks {
 		track.edit.SetReadOnly(true)
-		if !track.disabled {
-			chars := []byte(track.edit.Text())
-			rawTracks[i] = track.encode(chars)
+		if chars := []byte(track.edit.Text()); !track.disabled && len(chars) > 0 {
+			raw, err := track.encode(chars)
+			if err != nil {
+				a.throwErr(err)
+				return
+			}
+			job.Tracks[i] = raw
 		}
 	}
-	err := a.device.WriteRawTracks(rawTracks[0], rawTracks[1], rawTracks[2])
-	if err != nil {
+	if err := a.do(&job); err != nil {
 		a.throwErr(err)
 	}
 }
@@ -259,28 +321,25 @@ func (a *App) writeRaw() {
 func (a *App) erase() {
 	a.freeze()
 	defer a.unfreeze()
-	var tracks [3]bool
+	var job libmsr.EraseJob
 	for i, t := range a.tracks {
 		if !t.disabled {
-			tracks[i] = true
+			job.Tracks[i] = true
 			t.edit.SetText("")
 		}
 	}
-	err := a.device.Erase(tracks[0], tracks[1], tracks[2])
-	if err != nil {
+	if err := a.do(&job); err != nil {
 		a.throwErr(err)
 	}
 }
 
 func (a *App) setCoercivity(r *ui.RadioButtons) {
-	a.mu.Lock()
-	defer a.mu.Unlock()
 	var err error
 	switch r.Selected() {
 	case hiCo:
-		err = a.device.SetHiCo()
+		err = a.do(libmsr.JobFunc((*libmsr.Device).SetHiCo))
 	case loCo:
-		err = a.device.SetLoCo()
+		err = a.do(libmsr.JobFunc((*libmsr.Device).SetLoCo))
 	}
 	if err != nil {
 		a.throwErr(err)
@@ -290,17 +349,25 @@ func (a *App) setCoercivity(r *ui.RadioButtons) {
 func (a *App) showInfo(*ui.Button) {
 	var in libtracks.Informer
 	var err error
+	title := "Card Info"
 	switch a.infoTypeCB.Selected() {
 	case infoIEC7813:
 		in, err = libtracks.NewIEC7813Tracks(a.tracks[0].edit.Text(), a.tracks[1].edit.Text())
 	case infoAAMVA:
 		in, err = libtracks.NewAAMVATracks(a.tracks[0].edit.Text(), a.tracks[1].edit.Text(), a.tracks[2].edit.Text())
+	case infoAuto:
+		var m *libtracks.Match
+		m, _, err = libtracks.Parse(a.tracks[0].edit.Text(), a.tracks[1].edit.Text(), a.tracks[2].edit.Text())
+		if err == nil {
+			in = m.Informer
+			title = fmt.Sprintf("Card Info (%s, %.0f%% sure)", m.Format, 100*m.Confidence)
+		}
 	}
 	if err != nil {
 		a.throwErr(err)
 		return
 	}
-	win := ui.NewWindow("Card Info", 640, 480, false)
+	win := ui.NewWindow(title, 640, 480, false)
 	win.SetMargined(true)
 	hBox := ui.NewHorizontalBox()
 	vBox := ui.NewVerticalBox()
@@ -330,7 +397,7 @@ func (a *App) saveFile(b *ui.Button) {
 
 func (a *App) onClosing(*ui.Window) bool {
 	if a.device != nil {
-		a.device.Close()
+		a.closeDevice()
 	}
 	return true
 }
@@ -371,12 +438,15 @@ func MakeMainUI(win *ui.Window) ui.Control {
 	a.infoTypeCB = ui.NewCombobox()
 	a.infoTypeCB.Append("ISO/IEC 7813")
 	a.infoTypeCB.Append("AAMVA DL")
+	a.infoTypeCB.Append("Auto")
+	a.detectCB = ui.NewCheckbox("Detect format")
 	a.showInfoButton = ui.NewButton("Show info")
 	a.showInfoButton.OnClicked(a.showInfo)
 	sideMenu.Append(a.deviceCB, false)
 	sideMenu.Append(a.refreshButton, false)
 	sideMenu.Append(a.coRadio, false)
 	sideMenu.Append(a.presetRadio, false)
+	sideMenu.Append(a.detectCB, false)
 	sideMenu.Append(a.infoTypeCB, false)
 	sideMenu.Append(a.showInfoButton, false)
 
@@ -420,9 +490,8 @@ func MakeMainUI(win *ui.Window) ui.Control {
 	if len(a.availableDevs) > 0 {
 		d, err := a.availableDevs[0].Open()
 		if err == nil {
-			a.device = libmsr.NewDevice(d)
 			a.deviceCB.SetSelected(1)
-			a.connect(d)
+			a.connect(*a.availableDevs[0], d)
 		}
 	}
 	return vBox
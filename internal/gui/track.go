@@ -7,7 +7,10 @@ import (
 	"github.com/egginabucket/openmsr/pkg/libmsr"
 )
 
-const minBPC = 4
+const (
+	minBPC = 4
+	maxBPC = 7
+)
 
 const (
 	bpi210 = iota
@@ -43,6 +46,7 @@ type Track struct {
 	bpiCB    *ui.Combobox
 	bpcCB    *ui.Combobox
 	parityCB *ui.Combobox
+	capLabel *ui.Label
 	disabled bool
 	//evenParity bool
 	//data       []byte
@@ -74,65 +78,78 @@ func (t *Track) onToggle(cb *ui.Checkbox) {
 func (t *Track) setPreset(p Preset) {
 	switch p {
 	case PresetISO:
-		switch t.num {
-		case 1:
-			t.bpiCB.SetSelected(bpi210)
-			t.bpcCB.SetSelected(7 - minBPC)
-		case 2:
-			t.bpiCB.SetSelected(bpi75)
-			t.bpcCB.SetSelected(5 - minBPC)
-		case 3:
-			t.bpiCB.SetSelected(bpi210)
-			t.bpcCB.SetSelected(5 - minBPC)
-		}
-		t.parityCB.SetSelected(parityOdd)
+		t.setFormat(libmsr.ISOFormats[t.num-1])
 	case PresetAAMVA:
-		switch t.num {
-		case 1:
-			t.bpiCB.SetSelected(bpi210)
-			t.bpcCB.SetSelected(7 - minBPC)
-		case 2:
-			t.bpiCB.SetSelected(bpi75)
-			t.bpcCB.SetSelected(5 - minBPC)
-		case 3:
-			t.bpiCB.SetSelected(bpi210)
-			t.bpcCB.SetSelected(7 - minBPC)
-		}
+		t.setFormat(libmsr.AAMVAFormats[t.num-1])
+	}
+}
+
+func (t *Track) setFormat(f libmsr.TrackFormat) {
+	if f.BitsPerInch == 75 {
+		t.bpiCB.SetSelected(bpi75)
+	} else {
+		t.bpiCB.SetSelected(bpi210)
+	}
+	t.bpcCB.SetSelected(f.BitsPerChar - minBPC)
+	if f.Parity == libmsr.ParityEven {
+		t.parityCB.SetSelected(parityEven)
+	} else {
 		t.parityCB.SetSelected(parityOdd)
 	}
 	t.checkEdit()
 }
 
+// detectFormat selects the most likely format of raw
+// that can be selected, if any.
+// The bits per inch are kept, as they can't be detected.
+func (t *Track) detectFormat(raw []byte) {
+	for _, c := range libmsr.DetectFormat(raw) {
+		if c.Confidence < 0.5 {
+			return
+		}
+		if c.Format.BitsPerChar <= maxBPC {
+			f := c.Format
+			f.BitsPerInch = t.bpi()
+			t.setFormat(f)
+			return
+		}
+	}
+}
+
 func (t *Track) bpc() int {
 	return minBPC + t.bpcCB.Selected()
 }
 
-func (t *Track) charOffset() byte {
-	switch t.bpc() {
-	case 4, 5:
-		return '0'
-	case 6, 7:
-		return ' '
+func (t *Track) bpi() int {
+	if t.bpiCB.Selected() == bpi75 {
+		return 75
+	}
+	return 210
+}
+
+func (t *Track) parity() libmsr.Parity {
+	if t.parityCB.Selected() == parityEven {
+		return libmsr.ParityEven
 	}
-	return ' '
+	return libmsr.ParityOdd
 }
 
-func (t *Track) parityEven() bool {
-	return t.parityCB.Selected() == parityEven
+func (t *Track) format() libmsr.TrackFormat {
+	return libmsr.NewTrackFormat(t.bpc(), t.parity(), t.bpi())
 }
 
 func (t *Track) decode(raw []byte) (chars []byte, parityOK []bool, lrcOK bool) {
-	return libmsr.DecodeRaw(raw, t.charOffset(), t.bpc(), 8, t.parityEven())
+	return libmsr.DecodeTrack(raw, t.format())
 }
 
-func (t *Track) encode(chars []byte) []byte {
-	return libmsr.EncodeRaw(chars, t.charOffset(), t.bpc(), 8, t.parityEven())
+func (t *Track) encode(chars []byte) ([]byte, error) {
+	return libmsr.EncodeTrack(chars, t.format(), libmsr.DefaultLeadingZeros.Track(t.num-1))
 }
 
 func (t *Track) checkEdit() {
 	text := t.edit.Text()
 	b := make([]byte, 0, len(text))
-	min := rune(t.charOffset())
+	min := rune(t.format().CharOffset)
 	max := min + (1 << rune(t.bpc()))
 	changed := false
 	for _, r := range text {
@@ -148,6 +165,13 @@ func (t *Track) checkEdit() {
 	if changed {
 		t.edit.SetText(string(b))
 	}
+	// counted the same way as when writing
+	f := t.format()
+	if max := libmsr.Capacity(f, libmsr.DefaultLeadingZeros.Track(t.num-1)); max >= 0 {
+		t.capLabel.SetText(fmt.Sprintf("%d chars left", max-libmsr.DataLen(b, f)))
+	} else {
+		t.capLabel.SetText("")
+	}
 }
 
 func (t *Track) onEdit(e *ui.Entry) {
@@ -158,6 +182,10 @@ func (t *Track) onBPCChange(cb *ui.Combobox) {
 	t.checkEdit()
 }
 
+func (t *Track) onBPIChange(cb *ui.Combobox) {
+	t.checkEdit()
+}
+
 /*
 func (t *Track) onBPISelected(cb *ui.Combobox) {
 	switch cb.Selected() {
@@ -197,18 +225,21 @@ func newTrack(num int) *Track {
 	t.bpiCB.Append("210 bits per inch")
 	t.bpiCB.Append("75 bits per inch")
 	t.bpcCB = ui.NewCombobox()
-	for bpc := minBPC; bpc <= 7; bpc++ {
+	for bpc := minBPC; bpc <= maxBPC; bpc++ {
 		t.bpcCB.Append(fmt.Sprintf("%d bits per char", bpc))
 	}
 	t.bpcCB.OnSelected(t.onBPCChange)
 	t.parityCB = ui.NewCombobox()
 	t.parityCB.Append("Odd parity")
 	t.parityCB.Append("Even parity")
+	t.capLabel = ui.NewLabel("")
 
 	hbox.Append(t.bpiCB, false)
 	hbox.Append(t.bpcCB, false)
 	hbox.Append(t.parityCB, false)
+	hbox.Append(t.capLabel, false)
 	//t.bpiCB.OnSelected(t.onBPISelected)
+	t.bpiCB.OnSelected(t.onBPIChange)
 
 	t.edit = ui.NewEntry()
 	t.edit.OnChanged(t.onEdit)
@@ -0,0 +1,164 @@
+package libmsr
+
+import (
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"sync"
+)
+
+const (
+	packetLen       = 64
+	bridgeQueueSize = 16
+)
+
+// BridgeServer shares a local device's packet stream over TCP,
+// so that a remote Device can use it through DialBridge.
+// Clients are served one at a time, in the order they connect.
+type BridgeServer struct {
+	Transport Transport
+	// TLSConfig enables TLS if non-nil.
+	// Set ClientAuth to tls.RequireAndVerifyClientCert and ClientCAs for mutual TLS.
+	TLSConfig *tls.Config
+	once      sync.Once
+	pkts      chan []byte
+	readDone  chan struct{}
+	readErr   error // set before readDone is closed
+}
+
+// readTransport forwards packets from the transport until it fails.
+// Packets arriving while no client is connected are dropped.
+func (s *BridgeServer) readTransport() {
+	for {
+		pkt := make([]byte, packetLen)
+		if _, err := s.Transport.Read(pkt); err != nil {
+			s.readErr = err
+			close(s.readDone)
+			return
+		}
+		select {
+		case s.pkts <- pkt:
+		default:
+		}
+	}
+}
+
+func (s *BridgeServer) serveConn(conn net.Conn) {
+	defer conn.Close()
+	for len(s.pkts) > 0 { // left over from a previous client
+		<-s.pkts
+	}
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-s.readDone:
+				conn.Close()
+				return
+			case pkt := <-s.pkts:
+				if _, err := conn.Write(pkt); err != nil {
+					conn.Close()
+					return
+				}
+			}
+		}
+	}()
+	pkt := make([]byte, packetLen)
+	for {
+		if _, err := io.ReadFull(conn, pkt); err != nil {
+			break
+		}
+		if _, err := s.Transport.Write(pkt); err != nil {
+			break
+		}
+	}
+	close(done)
+}
+
+// Serve accepts connections on l and relays packets between them and s.Transport.
+// It returns when accepting fails or the transport can no longer be read.
+// Serve does not close s.Transport.
+func (s *BridgeServer) Serve(l net.Listener) error {
+	s.once.Do(func() {
+		s.pkts = make(chan []byte, bridgeQueueSize)
+		s.readDone = make(chan struct{})
+		go s.readTransport()
+	})
+	if s.TLSConfig != nil {
+		l = tls.NewListener(l, s.TLSConfig)
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		s.serveConn(conn)
+		select {
+		case <-s.readDone:
+			return s.readErr
+		default:
+		}
+	}
+}
+
+// ListenAndServe listens on the TCP address addr and calls Serve.
+func (s *BridgeServer) ListenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+	return s.Serve(l)
+}
+
+// bridgeConn is the client side of a BridgeServer connection.
+type bridgeConn struct {
+	conn net.Conn
+	rMu  sync.Mutex // Device may leave a read pending after a timeout
+}
+
+func (c *bridgeConn) Read(b []byte) (int, error) {
+	c.rMu.Lock()
+	defer c.rMu.Unlock()
+	var pkt [packetLen]byte
+	if _, err := io.ReadFull(c.conn, pkt[:]); err != nil {
+		return 0, err
+	}
+	return copy(b, pkt[:]), nil
+}
+
+func (c *bridgeConn) Write(b []byte) (int, error) {
+	if len(b) > packetLen {
+		return 0, errors.New("libmsr.bridgeConn.Write: packet too long")
+	}
+	var pkt [packetLen]byte
+	copy(pkt[:], b)
+	if _, err := c.conn.Write(pkt[:]); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *bridgeConn) Close() error {
+	return c.conn.Close()
+}
+
+// DialBridge connects to a BridgeServer at the TCP address addr,
+// using TLS if tlsConfig is non-nil.
+// The returned Transport can be passed to NewDevice.
+func DialBridge(addr string, tlsConfig *tls.Config) (Transport, error) {
+	var conn net.Conn
+	var err error
+	if tlsConfig != nil {
+		conn, err = tls.Dial("tcp", addr, tlsConfig)
+	} else {
+		conn, err = net.Dial("tcp", addr)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &bridgeConn{conn: conn}, nil
+}
@@ -0,0 +1,66 @@
+package libmsr
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"testing"
+)
+
+func TestBridgeLoopback(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	s := &BridgeServer{Transport: e}
+	go s.Serve(l)
+
+	conn, err := DialBridge(l.Addr().String(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := NewDevice(conn)
+	defer conn.Close()
+
+	if err := d.TestCommunication(); err != nil {
+		t.Fatal(err)
+	}
+	t1, t2 := []byte("%B4111111111111111^DOE/JOHN^2705101?"), []byte(";4111111111111111=2705101?")
+	if err := d.WriteISOTracks(t1, t2, nil); err != nil {
+		t.Fatal(err)
+	}
+	msg, err := d.ReadISOTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Contains(msg, t1) || !bytes.Contains(msg, t2) {
+		t.Errorf("read %q, want tracks %q and %q", msg, t1, t2)
+	}
+	if r := d.Diagnose(context.Background(), false); !r.Passed() {
+		t.Errorf("diagnose failed:\n%s", r)
+	}
+}
+
+func TestEmulatorRaw(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	d := NewDevice(e)
+	want := []byte(";4111111111111111=2705101?")
+	raw, err := EncodeTrack(want, ISOTrack2, DefaultLeadingZeros.Track2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := d.WriteRawTracks(nil, raw, nil); err != nil {
+		t.Fatal(err)
+	}
+	tracks, err := d.ReadRawTracks()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _, lrcOK := DecodeTrack(tracks[1], ISOTrack2); !bytes.Equal(got, want) || !lrcOK {
+		t.Errorf("read back %q (LRC ok %v), want %q", got, lrcOK, want)
+	}
+}
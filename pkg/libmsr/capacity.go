@@ -0,0 +1,124 @@
+package libmsr
+
+import (
+	"fmt"
+)
+
+// TrackLength is the length of a track that can be recorded, in inches,
+// from the first leading zero. After the default leading zeros,
+// it holds the ISO 7811 maximum lengths.
+const TrackLength = 3.0
+
+// DefaultLeadingZeros are the leading zeros a device starts with.
+var DefaultLeadingZeros = LeadingZeros{Track13: 61, Track2: 22}
+
+// CapacityError is returned when data doesn't fit on a track.
+type CapacityError struct {
+	Track    int // 0 if not known
+	Len, Max int // in characters, or bytes if Raw
+	Raw      bool
+}
+
+func (e *CapacityError) Error() string {
+	unit := "characters"
+	if e.Raw {
+		unit = "bytes"
+	}
+	track := "track"
+	if e.Track > 0 {
+		track = fmt.Sprintf("track %d", e.Track)
+	}
+	return fmt.Sprintf("libmsr: %d %s don't fit on %s, which holds %d", e.Len, unit, track, e.Max)
+}
+
+// trackBits returns the number of bits on a track at bpi,
+// or -1 if bpi isn't known.
+func trackBits(bpi int) int {
+	if bpi <= 0 {
+		return -1
+	}
+	return int(TrackLength * float64(bpi))
+}
+
+// maxChars returns the number of characters that fit in format f
+// after leadingZeros bits, including sentinels and LRC,
+// or -1 if there is no known limit.
+func (f *TrackFormat) maxChars(leadingZeros int) int {
+	n := -1
+	if bits := trackBits(f.BitsPerInch); bits >= 0 && f.BitsPerChar > 0 {
+		n = (bits - leadingZeros) / f.BitsPerChar
+		if n < 0 {
+			n = 0
+		}
+	}
+	if f.MaxLen > 0 && (n < 0 || n > f.MaxLen) {
+		n = f.MaxLen
+	}
+	return n
+}
+
+// Capacity returns the number of data characters that fit on a track in format f
+// after leadingZeros bits, leaving room for the sentinels and LRC.
+// It is limited by f.MaxLen, and is -1 if neither it nor f.BitsPerInch is set.
+func Capacity(f TrackFormat, leadingZeros int) int {
+	n := f.maxChars(leadingZeros)
+	if n < 0 {
+		return -1
+	}
+	if n -= 3; n < 0 {
+		return 0
+	}
+	return n
+}
+
+// DataLen returns the number of characters of t counted against Capacity:
+// a start sentinel at its start and an end sentinel at its end
+// are left out, as Capacity already leaves room for them.
+func DataLen(t []byte, f TrackFormat) int {
+	n := len(t)
+	if n > 0 && f.StartSentinel != 0 && t[0] == f.StartSentinel {
+		t, n = t[1:], n-1
+	}
+	if n > 0 && f.EndSentinel != 0 && t[n-1] == f.EndSentinel {
+		n--
+	}
+	return n
+}
+
+// trackFormat returns the format of track i (0-2) as last set on d.
+func (d *Device) trackFormat(i int) (f TrackFormat, leadingZeros int) {
+	f = ISOFormats[i]
+	if d.config.BPI[i] != 0 {
+		f.BitsPerInch = d.config.BPI[i]
+	}
+	if d.config.BPC[i] != 0 {
+		f = NewTrackFormat(d.config.BPC[i], f.Parity, f.BitsPerInch)
+	}
+	lz := DefaultLeadingZeros
+	if d.config.LeadingZeros != nil {
+		lz = *d.config.LeadingZeros
+	}
+	return f, lz.Track(i)
+}
+
+// checkCapacity checks that each track fits on the card.
+func (d *Device) checkCapacity(raw bool, tracks ...[]byte) error {
+	for i, t := range tracks {
+		if len(t) == 0 {
+			continue
+		}
+		f, lz := d.trackFormat(i)
+		n, max := DataLen(t, f), Capacity(f, lz)
+		if raw {
+			// Room for the sentinels and LRC, as packed by EncodeTrack.
+			n = len(t)
+			if m := f.maxChars(lz); m >= 0 {
+				max = (m*f.BitsPerChar + 7) / 8
+			}
+		}
+		if max >= 0 && n > max {
+			return &CapacityError{Track: i + 1, Len: n, Max: max, Raw: raw}
+		}
+	}
+	return nil
+}
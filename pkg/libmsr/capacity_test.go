@@ -0,0 +1,61 @@
+package libmsr
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fullTrack returns a track in format f with n data characters.
+func fullTrack(f TrackFormat, n int) []byte {
+	data := bytes.Repeat([]byte{f.char(1)}, n)
+	return append(append([]byte{f.StartSentinel}, data...), f.EndSentinel)
+}
+
+func TestEncodeTrackCapacity(t *testing.T) {
+	for i, f := range ISOFormats {
+		lz := DefaultLeadingZeros.Track(i)
+		max := Capacity(f, lz)
+		if _, err := EncodeTrack(fullTrack(f, max), f, lz); err != nil {
+			t.Errorf("%s: %d chars: %v", f.Name, max, err)
+		}
+		_, err := EncodeTrack(fullTrack(f, max+1), f, lz)
+		var ce *CapacityError
+		if !errors.As(err, &ce) || ce.Len != max+1 || ce.Max != max {
+			t.Errorf("%s: %d chars: error %v", f.Name, max+1, err)
+		}
+	}
+}
+
+// TestWriteCapacity checks that the device takes every track
+// that EncodeTrack and Capacity take, whether raw or not.
+func TestWriteCapacity(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	d := NewDevice(e)
+	var full, raw, over [3][]byte
+	for i, f := range ISOFormats {
+		lz := DefaultLeadingZeros.Track(i)
+		full[i] = fullTrack(f, Capacity(f, lz))
+		over[i] = fullTrack(f, Capacity(f, lz)+1)
+		var err error
+		if raw[i], err = EncodeTrack(full[i], f, lz); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := d.WriteISOTracks(full[0], full[1], full[2]); err != nil {
+		t.Errorf("full ISO tracks: %v", err)
+	}
+	if err := d.WriteRawTracks(raw[0], raw[1], raw[2]); err != nil {
+		t.Errorf("full raw tracks: %v", err)
+	}
+	for i := range over {
+		tracks := full
+		tracks[i] = over[i]
+		err := d.WriteISOTracks(tracks[0], tracks[1], tracks[2])
+		var ce *CapacityError
+		if !errors.As(err, &ce) || ce.Track != i+1 {
+			t.Errorf("track %d over capacity: error %v", i+1, err)
+		}
+	}
+}
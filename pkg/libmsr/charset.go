@@ -0,0 +1,127 @@
+package libmsr
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Charset maps the codes on a track to characters.
+type Charset struct {
+	Name  string
+	chars [256]int16 // by code, -1 if not mapped
+	codes [256]int16 // by char, -1 if not mapped
+}
+
+// NewCharset returns a charset mapping each code in chars to a character.
+// No two codes may map to the same character.
+func NewCharset(name string, chars map[byte]byte) (*Charset, error) {
+	cs := &Charset{Name: name}
+	for i := range cs.chars {
+		cs.chars[i], cs.codes[i] = -1, -1
+	}
+	for code, c := range chars {
+		if cs.codes[c] >= 0 {
+			return nil, fmt.Errorf("libmsr.NewCharset: %q mapped twice", c)
+		}
+		cs.chars[code], cs.codes[c] = int16(c), int16(code)
+	}
+	return cs, nil
+}
+
+func offsetCharset(name string, offset byte, n int) *Charset {
+	chars := make(map[byte]byte, n)
+	for code := 0; code < n; code++ {
+		chars[byte(code)] = offset + byte(code)
+	}
+	cs, _ := NewCharset(name, chars)
+	return cs
+}
+
+var (
+	ISO6Bit   = offsetCharset("ISO 7811 6-bit", ' ', 64)
+	ISO4Bit   = offsetCharset("ISO 7811 4-bit", '0', 16)
+	ASCII7Bit = offsetCharset("ASCII 7-bit", 0, 128)
+)
+
+// Char returns the character for code, if it is mapped.
+func (cs *Charset) Char(code byte) (byte, bool) {
+	c := cs.chars[code]
+	return byte(c), c >= 0
+}
+
+// Code returns the code for character c, if it is mapped.
+func (cs *Charset) Code(c byte) (byte, bool) {
+	code := cs.codes[c]
+	return byte(code), code >= 0
+}
+
+// ReadCharset reads a charset with one mapping per line:
+// a code, as a number such as 5 or 0x05, and its character,
+// as a single character or a number such as 0x25.
+// Blank lines and lines starting with # are ignored.
+func ReadCharset(name string, r io.Reader) (*Charset, error) {
+	chars := make(map[byte]byte)
+	s := bufio.NewScanner(r)
+	for line := 1; s.Scan(); line++ {
+		fields := strings.Fields(s.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("libmsr.ReadCharset: line %d: expected a code and a character", line)
+		}
+		code, err := strconv.ParseUint(fields[0], 0, 8)
+		if err != nil {
+			return nil, fmt.Errorf("libmsr.ReadCharset: line %d: %w", line, err)
+		}
+		c := uint64(fields[1][0])
+		if len(fields[1]) > 1 {
+			if c, err = strconv.ParseUint(fields[1], 0, 8); err != nil {
+				return nil, fmt.Errorf("libmsr.ReadCharset: line %d: %w", line, err)
+			}
+		}
+		chars[byte(code)] = byte(c)
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return NewCharset(name, chars)
+}
+
+// LoadCharset reads a charset from a file (see ReadCharset),
+// named after the file.
+func LoadCharset(path string) (*Charset, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	name := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	return ReadCharset(name, f)
+}
+
+// char returns the character for code in f.
+// Codes not in f.Charset decode to 0.
+func (f *TrackFormat) char(code byte) byte {
+	if f.Charset != nil {
+		c, _ := f.Charset.Char(code)
+		return c
+	}
+	return code + f.CharOffset
+}
+
+// code returns the code for character c in f, if it has one.
+func (f *TrackFormat) code(c byte) (byte, bool) {
+	n := dataBits(f.BitsPerChar, f.Parity)
+	if f.Charset != nil {
+		code, ok := f.Charset.Code(c)
+		return code, ok && (n >= 8 || code < 1<<n)
+	}
+	code := c - f.CharOffset
+	return code, c >= f.CharOffset && (n >= 8 || code < 1<<n)
+}
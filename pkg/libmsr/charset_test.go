@@ -0,0 +1,78 @@
+package libmsr
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const testCharset = `# digits, then a few letters
+0 0
+0x01 1
+2 0x32
+
+0x0A A
+0x0B B
+`
+
+func TestReadCharset(t *testing.T) {
+	cs, err := ReadCharset("test", strings.NewReader(testCharset))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for code, want := range map[byte]byte{0: '0', 1: '1', 2: '2', 0x0A: 'A', 0x0B: 'B'} {
+		if c, ok := cs.Char(code); !ok || c != want {
+			t.Errorf("code %d is %q (%v), want %q", code, c, ok, want)
+		}
+		if got, ok := cs.Code(want); !ok || got != code {
+			t.Errorf("%q has code %d (%v), want %d", want, got, ok, code)
+		}
+	}
+	if _, ok := cs.Char(3); ok {
+		t.Error("unmapped code 3 has a char")
+	}
+	if _, ok := cs.Code('C'); ok {
+		t.Error("unmapped char 'C' has a code")
+	}
+}
+
+func TestReadCharsetErrors(t *testing.T) {
+	for _, text := range []string{
+		"1",         // no char
+		"1 A extra", // too many fields
+		"x A",       // bad code
+		"256 A",     // code out of range
+		"1 0x100",   // char out of range
+		"1 A\n2 A",  // char mapped twice
+	} {
+		if _, err := ReadCharset("test", strings.NewReader(text)); err == nil {
+			t.Errorf("%q: no error", text)
+		}
+	}
+}
+
+func TestLoadCharset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "digits.txt")
+	if err := os.WriteFile(path, []byte(testCharset), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := LoadCharset(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cs.Name != "digits" {
+		t.Errorf("named %q, want digits", cs.Name)
+	}
+	f := TrackFormat{BitsPerChar: 5, Charset: cs}
+	raw, err := EncodePacked([]byte("01AB2"), ReadPacking, f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := DecodePacked(raw, ReadPacking, f).Data(); string(got) != "01AB2" {
+		t.Errorf("decoded %q through the charset", got)
+	}
+	if _, err := LoadCharset(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Error("no error for a missing file")
+	}
+}
@@ -0,0 +1,96 @@
+package libmsr
+
+import (
+	"errors"
+)
+
+// LeadingZeros is the number of zero bits written before each track's data.
+// Tracks 1 and 3 share a setting.
+type LeadingZeros struct {
+	Track13, Track2 int
+}
+
+// Track returns the number of leading zeros of track i (0-2).
+func (z LeadingZeros) Track(i int) int {
+	if i == 1 {
+		return z.Track2
+	}
+	return z.Track13
+}
+
+// Config holds a device's settings, as last set through a Device.
+// Settings that haven't been set are nil or 0.
+type Config struct {
+	HiCo         *bool
+	BPI          [3]int
+	BPC          [3]int
+	LeadingZeros *LeadingZeros
+}
+
+// Config returns the settings last set through d.
+func (d *Device) Config() Config {
+	c := d.config
+	if c.HiCo != nil {
+		hiCo := *c.HiCo
+		c.HiCo = &hiCo
+	}
+	if c.LeadingZeros != nil {
+		lz := *c.LeadingZeros
+		c.LeadingZeros = &lz
+	}
+	return c
+}
+
+// ApplyConfig sets each of the settings set in c.
+func (d *Device) ApplyConfig(c Config) error {
+	var err error
+	if c.HiCo != nil {
+		if *c.HiCo {
+			err = d.SetHiCo()
+		} else {
+			err = d.SetLoCo()
+		}
+		if err != nil {
+			return err
+		}
+	}
+	if c.BPI != [3]int{} {
+		if err = d.SetBitsPerInch(c.BPI[0], c.BPI[1], c.BPI[2]); err != nil {
+			return err
+		}
+	}
+	if c.BPC != [3]int{} {
+		if err = d.SetBitsPerChar(c.BPC[0], c.BPC[1], c.BPC[2]); err != nil {
+			return err
+		}
+	}
+	if c.LeadingZeros != nil {
+		return d.SetLeadingZeros(c.LeadingZeros.Track13, c.LeadingZeros.Track2)
+	}
+	return nil
+}
+
+// SetLeadingZeros sets the number of zero bits written before the data
+// of tracks 1 and 3, and track 2.
+func (d *Device) SetLeadingZeros(t13, t2 int) error {
+	if t13 < 0 || t13 > 0xFF || t2 < 0 || t2 > 0xFF {
+		return errors.New("libmsr.Device.SetLeadingZeros: invalid leading zeros")
+	}
+	err := d.sendAndCheck(esc('z', byte(t13), byte(t2)), false)
+	if err == nil {
+		d.config.LeadingZeros = &LeadingZeros{t13, t2}
+	}
+	return err
+}
+
+// LeadingZeros checks the device's current leading zeros.
+func (d *Device) LeadingZeros() (LeadingZeros, error) {
+	msg, err := d.sendAndReceive(esc('l'), false)
+	if err != nil {
+		return LeadingZeros{}, err
+	}
+	if len(msg) != 3 || msg[0] != escByte {
+		return LeadingZeros{}, errors.New("libmsr.Device.LeadingZeros: unknown response")
+	}
+	return LeadingZeros{int(msg[1]), int(msg[2])}, nil
+}
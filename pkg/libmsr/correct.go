@@ -0,0 +1,85 @@
+package libmsr
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrAmbiguous is returned by Frame.Correct
+// when errors can't be located to a single bit.
+var ErrAmbiguous = errors.New("libmsr: errors can't be corrected unambiguously")
+
+// Correction is a bit flipped by Frame.Correct.
+type Correction struct {
+	Index int // in Frame.Data
+	// Bit is the flipped bit of the character's code,
+	// or BitsPerChar-1 for its parity bit, which leaves the data as is.
+	Bit      int
+	Old, New byte
+}
+
+func (c *Correction) String() string {
+	return fmt.Sprintf("char %d bit %d: %q -> %q", c.Index, c.Bit, c.Old, c.New)
+}
+
+// lrc returns the LRC of the sentinels and data,
+// or false if a character has no code.
+func (fr *Frame) lrc() (byte, bool) {
+	f := &fr.Format
+	ss, _ := f.code(f.StartSentinel)
+	es, _ := f.code(f.EndSentinel)
+	lrc := ss ^ es
+	for _, c := range fr.Data {
+		code, ok := f.code(c)
+		if !ok {
+			return 0, false
+		}
+		lrc ^= code
+	}
+	return lrc, true
+}
+
+// Correct repairs a single flipped bit in a single character,
+// located by its parity and the LRC, and returns what it changed.
+// It returns nil if there are no errors,
+// and ErrAmbiguous if the errors can't be pinned down to one bit,
+// in which case fr is left as is.
+func (fr *Frame) Correct() (*Correction, error) {
+	bad := -1
+	for i, ok := range fr.ParityOK {
+		if !ok {
+			if bad >= 0 {
+				return nil, ErrAmbiguous
+			}
+			bad = i
+		}
+	}
+	if bad < 0 && fr.LRCOK {
+		return nil, nil
+	}
+	if bad < 0 || !fr.HasEnd || !fr.HasLRC || !fr.LRCParityOK {
+		return nil, ErrAmbiguous
+	}
+	f := &fr.Format
+	lrc, ok := fr.lrc()
+	if !ok {
+		return nil, ErrAmbiguous
+	}
+	c := &Correction{Index: bad, Old: fr.Data[bad]}
+	switch diff := lrc ^ fr.LRC; {
+	case diff == 0:
+		c.Bit = f.BitsPerChar - 1
+	case diff&(diff-1) == 0:
+		for diff>>c.Bit != 1 {
+			c.Bit++
+		}
+		code, _ := f.code(c.Old)
+		fr.Data[bad] = f.char(code ^ diff)
+	default:
+		return nil, ErrAmbiguous
+	}
+	c.New = fr.Data[bad]
+	fr.ParityOK[bad] = true
+	fr.LRCOK = true
+	return c, nil
+}
@@ -0,0 +1,74 @@
+package libmsr
+
+import (
+	"bytes"
+	"testing"
+)
+
+const correctTrack = ";4111111111111111=2705101?"
+
+// flippedFrame decodes correctTrack on ISO track 2 with the given bits
+// of its characters flipped, each as {char, bit}, the start sentinel being char 0.
+func flippedFrame(t *testing.T, flips ...[2]int) *Frame {
+	t.Helper()
+	const lead = 20
+	bits := swipeBits(t, []byte(correctTrack), ISOTrack2, lead)
+	for _, f := range flips {
+		bits[lead+f[0]*ISOTrack2.BitsPerChar+f[1]] ^= 1
+	}
+	fr, err := DecodeFrame(RawTrackFromBits(bits), ISOTrack2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fr
+}
+
+func TestCorrect(t *testing.T) {
+	want := []byte(correctTrack[1 : len(correctTrack)-1])
+	es, _ := ISOTrack2.code(ISOTrack2.EndSentinel)
+	for char := 1; char <= len(want); char++ {
+		for bit := 0; bit < ISOTrack2.BitsPerChar; bit++ {
+			fr := flippedFrame(t, [2]int{char, bit})
+			c, err := fr.Correct()
+			if code, _ := ISOTrack2.code(want[char-1]); code^1<<bit == es {
+				// Turned into an end sentinel, so the frame ends early.
+				if err != ErrAmbiguous {
+					t.Errorf("char %d bit %d: corrected %v, %v", char, bit, c, err)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("char %d bit %d: %v", char, bit, err)
+			}
+			if c == nil || c.Index != char-1 || c.Bit != bit || c.New != want[char-1] {
+				t.Fatalf("char %d bit %d: corrected %v", char, bit, c)
+			}
+			if !bytes.Equal(fr.Data, want) || !fr.LRCOK || !fr.ParityOK[char-1] {
+				t.Fatalf("char %d bit %d: corrected to %q (LRC ok %v)", char, bit, fr.Data, fr.LRCOK)
+			}
+		}
+	}
+}
+
+func TestCorrectNoErrors(t *testing.T) {
+	if c, err := flippedFrame(t).Correct(); c != nil || err != nil {
+		t.Errorf("corrected %v, %v without errors", c, err)
+	}
+}
+
+func TestCorrectAmbiguous(t *testing.T) {
+	for _, flips := range [][][2]int{
+		{{3, 0}, {7, 1}},  // two parity errors
+		{{3, 0}, {3, 1}},  // parity ok, LRC wrong
+		{{3, 0}, {25, 2}}, // bad LRC
+	} {
+		fr := flippedFrame(t, flips...)
+		data := append([]byte(nil), fr.Data...)
+		if c, err := fr.Correct(); err != ErrAmbiguous {
+			t.Errorf("flips %v: corrected %v, %v", flips, c, err)
+		}
+		if !bytes.Equal(fr.Data, data) {
+			t.Errorf("flips %v: data changed to %q", flips, fr.Data)
+		}
+	}
+}
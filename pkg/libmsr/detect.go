@@ -0,0 +1,65 @@
+package libmsr
+
+import (
+	"sort"
+)
+
+// Candidate is a format that raw track data may be in.
+type Candidate struct {
+	Format     TrackFormat
+	Frame      *Frame
+	Confidence float64 // from 0 to 1
+}
+
+// confidence rates how likely it is that fr is in the right format.
+func (fr *Frame) confidence() float64 {
+	c := 0.2 // found a start sentinel
+	if fr.HasEnd {
+		c += 0.3
+	}
+	if fr.LRCOK {
+		c += 0.3
+	}
+	if len(fr.Data) > 0 {
+		ok := 0
+		for _, p := range fr.ParityOK {
+			if p {
+				ok++
+			}
+		}
+		c += 0.2 * float64(ok) / float64(len(fr.Data))
+	} else if fr.HasEnd {
+		c += 0.2
+	}
+	if fr.LeadingJunk > 0 || fr.TrailingJunk > 0 {
+		c *= 0.8 // likely found by chance in another format
+	}
+	return c
+}
+
+// DetectFormat tries decoding raw data from Device.ReadRawTracks
+// with each bits per char and parity, forwards and backwards,
+// and returns the formats that found a start sentinel,
+// most likely first.
+// BitsPerInch can't be told from the data, so it is left 0.
+func DetectFormat(raw []byte) []Candidate {
+	cands := make([]Candidate, 0)
+	for bpc := 5; bpc <= 8; bpc++ {
+		for _, p := range []Parity{ParityOdd, ParityEven} {
+			f := NewTrackFormat(bpc, p, 0)
+			fr, err := DecodeFrame(raw, f)
+			if err != nil {
+				continue
+			}
+			cands = append(cands, Candidate{
+				Format:     f,
+				Frame:      fr,
+				Confidence: fr.confidence(),
+			})
+		}
+	}
+	sort.SliceStable(cands, func(i, j int) bool {
+		return cands[i].Confidence > cands[j].Confidence
+	})
+	return cands
+}
@@ -0,0 +1,66 @@
+package libmsr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+// swipeBits returns the bits of chars in format f as read from a card,
+// after lead zero bits.
+func swipeBits(t *testing.T, chars []byte, f TrackFormat, lead int) []byte {
+	t.Helper()
+	raw, err := EncodeTrack(chars, f, lead)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return append(make([]byte, lead), WritePacking.Unpack(raw)...)
+}
+
+func TestDetectFormat(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, f := range ISOFormats {
+		for _, reversed := range []bool{false, true} {
+			for i := 0; i < 100; i++ {
+				chars := randomTrack(rnd, f, 30)
+				bits := swipeBits(t, chars, f, 20)
+				if reversed {
+					bits = append(make([]byte, 20), reverseBits(bits)...)
+				}
+				cands := DetectFormat(RawTrackFromBits(bits))
+				if len(cands) == 0 {
+					t.Fatalf("%s: no candidates for %q", f.Name, chars)
+				}
+				c := cands[0]
+				if c.Format.BitsPerChar != f.BitsPerChar || c.Format.Parity != f.Parity {
+					t.Fatalf("%s: detected %d BPC, parity %d for %q", f.Name, c.Format.BitsPerChar, c.Format.Parity, chars)
+				}
+				if c.Confidence != 1 || c.Frame.Reversed != reversed ||
+					!bytes.Equal(c.Frame.Data, chars[1:len(chars)-1]) {
+					t.Errorf("%s: decoded %q (reversed %v) with confidence %.2f, want %q",
+						f.Name, c.Frame.Data, c.Frame.Reversed, c.Confidence, chars)
+				}
+			}
+		}
+	}
+}
+
+func TestDetectFormatRanked(t *testing.T) {
+	bits := swipeBits(t, []byte(";4111111111111111=2705101?"), ISOTrack2, 20)
+	bits[20+5*3] ^= 1 // a parity error lowers the confidence
+	cands := DetectFormat(RawTrackFromBits(bits))
+	for i := 1; i < len(cands); i++ {
+		if cands[i].Confidence > cands[i-1].Confidence {
+			t.Fatalf("candidate %d is more likely than %d", i, i-1)
+		}
+	}
+	if c := cands[0]; c.Format.BitsPerChar != 5 || c.Confidence >= 1 || c.Confidence < 0.5 {
+		t.Errorf("detected %d BPC with confidence %.2f", c.Format.BitsPerChar, c.Confidence)
+	}
+}
+
+func TestDetectFormatBlank(t *testing.T) {
+	if cands := DetectFormat(make([]byte, 40)); len(cands) != 0 {
+		t.Errorf("found %d candidates on a blank track", len(cands))
+	}
+}
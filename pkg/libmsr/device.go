@@ -1,21 +1,47 @@
 package libmsr
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"sync"
 	"time"
-
-	"github.com/karalabe/usb"
 )
 
+// Transport carries 64 byte HID reports to and from a device.
+// It is satisfied by usb.Device from github.com/karalabe/usb.
+type Transport interface {
+	Read(b []byte) (int, error)
+	Write(b []byte) (int, error)
+	Close() error
+}
+
 type Device struct {
-	device       usb.Device
+	device       Transport
 	PreSendDelay time.Duration
 	CheckTimeout,
 	SwipeTimeout time.Duration
+	LEDPolicy *LEDPolicy // nil disables automatic LED feedback
+	config    Config
+	cmdMu     sync.Mutex // held while a command is sent and answered
+	ledMu     sync.Mutex // taken after cmdMu
+	ledGen    int
+	ledTimer  *time.Timer
+	swipeMu   sync.Mutex
+	swipe     *swipeWatch // set by a Queue while it runs a job
 }
 
+// swipeWatch follows the swipe waits of a running job.
+type swipeWatch struct {
+	started func()          // called when a swipe wait starts
+	cancel  <-chan struct{} // closed to cancel swipe waits
+}
+
+// ErrSwipeCancelled is returned by operations whose swipe wait
+// was cancelled, eg. by Handle.Cancel.
+var ErrSwipeCancelled = errors.New("libmsr: swipe cancelled")
+
 type LEDMode byte
 
 const (
@@ -31,12 +57,26 @@ const (
 	ProductID uint16 = 0x0003
 )
 
+// TransportError is returned when reading from or writing to
+// a device's transport fails, such as when it is unplugged.
+type TransportError struct {
+	Err error
+}
+
+func (e *TransportError) Error() string {
+	return "libmsr: transport: " + e.Err.Error()
+}
+
+func (e *TransportError) Unwrap() error {
+	return e.Err
+}
+
 func (d *Device) send(msg []byte) error {
 	time.Sleep(d.PreSendDelay)
 	for _, pkt := range makePackets(msg) {
 		_, err := d.device.Write(pkt) // HID null byte handled in karalabe/usb
 		if err != nil {
-			return err
+			return &TransportError{err}
 		}
 	}
 	return nil
@@ -46,16 +86,44 @@ func (d *Device) receivePacket(pktChan chan []byte, errChan chan error) {
 	pkt := make([]byte, 64)
 	_, err := d.device.Read(pkt)
 	if err != nil {
-		errChan <- err
+		errChan <- &TransportError{err}
 		return
 	}
 	pktChan <- pkt
 }
 
+// setTransport replaces the device's transport, eg. after reconnecting.
+func (d *Device) setTransport(t Transport) {
+	d.cmdMu.Lock() // LED timers may be sending
+	defer d.cmdMu.Unlock()
+	d.device = t
+}
+
+func (d *Device) setSwipeWatch(w *swipeWatch) {
+	d.swipeMu.Lock()
+	defer d.swipeMu.Unlock()
+	d.swipe = w
+}
+
+// swipeStarted returns a channel closed if the swipe wait is cancelled,
+// or nil if nothing watches it.
+func (d *Device) swipeStarted() <-chan struct{} {
+	d.swipeMu.Lock()
+	w := d.swipe
+	d.swipeMu.Unlock()
+	if w == nil {
+		return nil
+	}
+	w.started()
+	return w.cancel
+}
+
 func (d *Device) receive(swipeWait bool) ([]byte, error) {
 	var timeout time.Duration
+	var cancelled <-chan struct{}
 	if swipeWait {
 		timeout = d.SwipeTimeout
+		cancelled = d.swipeStarted()
 	} else {
 		timeout = d.CheckTimeout
 	}
@@ -70,6 +138,9 @@ packets:
 		select {
 		case <-ctxTimeout.Done():
 			return nil, ctxTimeout.Err()
+		case <-cancelled:
+			d.Reset() // stop waiting on the device too
+			return nil, ErrSwipeCancelled
 		case pkt := <-pktChan:
 			pkts = append(pkts, pkt)
 			if pkt[0]&seqEndBit == seqEndBit {
@@ -93,6 +164,8 @@ func (d *Device) receiveEncoded(swipeWait bool) (data, result []byte, err error)
 }
 
 func (d *Device) sendAndReceive(msg []byte, swipeWait bool) ([]byte, error) {
+	d.cmdMu.Lock()
+	defer d.cmdMu.Unlock()
 	err := d.send(msg)
 	if err != nil {
 		return nil, err
@@ -101,6 +174,8 @@ func (d *Device) sendAndReceive(msg []byte, swipeWait bool) ([]byte, error) {
 }
 
 func (d *Device) sendAndReceiveEncoded(msg []byte, swipeWait bool) (data, result []byte, err error) {
+	d.cmdMu.Lock()
+	defer d.cmdMu.Unlock()
 	err = d.send(msg)
 	if err != nil {
 		return
@@ -115,6 +190,8 @@ func (d *Device) sendAndCheck(msg []byte, swipeWait bool) error {
 
 // TestCommunication verifies the connection with the device.
 func (d *Device) TestCommunication() error {
+	d.cmdMu.Lock()
+	defer d.cmdMu.Unlock()
 	err := d.send(esc('e'))
 	if err != nil {
 		return err
@@ -142,12 +219,24 @@ func (d *Device) TestRAM() error {
 
 // SetLoCo sets the device to write Lo-Co cards.
 func (d *Device) SetLoCo() error {
-	return d.sendAndCheck(esc('x'), false)
+	return d.setCoercivity(false)
 }
 
 // SetHiCo sets the device to write Hi-Co cards.
 func (d *Device) SetHiCo() error {
-	return d.sendAndCheck(esc('y'), false)
+	return d.setCoercivity(true)
+}
+
+func (d *Device) setCoercivity(hiCo bool) error {
+	cmd := esc('x')
+	if hiCo {
+		cmd = esc('y')
+	}
+	err := d.sendAndCheck(cmd, false)
+	if err == nil {
+		d.config.HiCo = &hiCo
+	}
+	return err
 }
 
 // IsHiCo checks the device's current write coercivity.
@@ -194,12 +283,31 @@ func (d *Device) SetBitsPerInch(t1, t2, t3 int) error {
 	default:
 		return invalidBPI
 	}
-	return d.sendAndCheck(cmd, false)
+	err := d.sendAndCheck(cmd, false)
+	if err != nil {
+		return err
+	}
+	for i, bpi := range [3]int{t1, t2, t3} {
+		if bpi != 0 {
+			d.config.BPI[i] = bpi
+		}
+	}
+	return nil
 }
 
 // SetBitsPerChar sets the number of bits (including parity) for each track.
+// Returns an error if the device echoes different settings.
 func (d *Device) SetBitsPerChar(t1, t2, t3 int) error {
-	return d.sendAndCheck(esc('o', byte(t1), byte(t2), byte(t3)), false)
+	bpc := []byte{byte(t1), byte(t2), byte(t3)}
+	_, result, err := d.sendAndReceiveEncoded(append(esc('o'), bpc...), false)
+	if err != nil {
+		return err
+	}
+	if len(result) > 0 && !bytes.Equal(result, bpc) {
+		return fmt.Errorf("libmsr.Device.SetBitsPerChar: device set %v, want %v", result, bpc)
+	}
+	d.config.BPC = [3]int{t1, t2, t3}
+	return nil
 }
 
 // Erase clears the selected tracks on a card.
@@ -215,37 +323,64 @@ func (d *Device) Erase(t1, t2, t3 bool) error {
 	if t3 {
 		mask |= 1 << 2
 	}
-	return d.sendAndCheck(esc('c', mask), true)
+	return d.withLED(OpErase, func() error {
+		return d.sendAndCheck(esc('c', mask), true)
+	})
+}
+
+func (d *Device) writeTracks(cmd byte, raw bool, t1, t2, t3 []byte) error {
+	if err := d.checkCapacity(raw, t1, t2, t3); err != nil {
+		return err
+	}
+	data, err := encodeTracks(raw, t1, t2, t3)
+	if err != nil {
+		return err
+	}
+	return d.withLED(OpWrite, func() error {
+		return d.sendAndCheck(append(esc(cmd), data...), true)
+	})
 }
 
 // WriteRawTracks writes raw data to a card.
 // Data can be encoded with EncodeRaw.
+// Empty tracks are left untouched on the card; use Erase to clear them.
+// Returns a *CapacityError if a track doesn't fit.
 // Does not return until a card is swiped or d.SwipeTimeout is reached.
 func (d *Device) WriteRawTracks(t1, t2, t3 []byte) error {
-	return d.sendAndCheck(append(esc('n'), encodeRawTracks(t1, t2, t3)...), true)
+	return d.writeTracks('n', true, t1, t2, t3)
 }
 
 // WriteISOTracks writes ISO data to a card.
+// Empty tracks are left untouched on the card; use Erase to clear them.
+// Returns a *CapacityError if a track doesn't fit.
 // Does not return until a card is swiped or d.SwipeTimeout is reached.
 func (d *Device) WriteISOTracks(t1, t2, t3 []byte) error {
-	return d.sendAndCheck(append(esc('w'), encodeISOTracks(t1, t2, t3)...), true)
+	return d.writeTracks('w', false, t1, t2, t3)
 }
 
 // ReadISOTracks reads ISO data from a card.
 // Does not return until a card is swiped or d.SwipeTimeout is reached.
-func (d *Device) ReadISOTracks() ([]byte, error) {
-	return d.sendAndReceive(esc('r'), true)
+func (d *Device) ReadISOTracks() (msg []byte, err error) {
+	err = d.withLED(OpRead, func() error {
+		msg, err = d.sendAndReceive(esc('r'), true)
+		return err
+	})
+	return
 }
 
 // WriteRawTracks reads raw data from a card.
 // Data can be decoded with DecodeRaw.
 // Does not return until a card is swiped or d.SwipeTimeout is reached.
-func (d *Device) ReadRawTracks() ([3][]byte, error) {
-	data, _, err := d.sendAndReceiveEncoded(esc('m'), true)
-	if err != nil {
-		return [3][]byte{}, err
-	}
-	return decodeTracks(data)
+func (d *Device) ReadRawTracks() (tracks [3][]byte, err error) {
+	err = d.withLED(OpRead, func() error {
+		data, _, err := d.sendAndReceiveEncoded(esc('m'), true)
+		if err != nil {
+			return err
+		}
+		tracks, err = decodeTracks(data)
+		return err
+	})
+	return
 }
 
 // Model returns the device's reported model.
@@ -265,17 +400,31 @@ func (d *Device) SetLED(mode LEDMode) error {
 	if mode > LEDRedOn {
 		return errors.New("libmsr.Device.SetLED: invalid LED mode")
 	}
+	d.cmdMu.Lock()
+	defer d.cmdMu.Unlock()
+	return d.setLED(mode)
+}
+
+// setLED must be called with d.cmdMu held.
+func (d *Device) setLED(mode LEDMode) error {
 	return d.send(esc(0x81 + byte(mode)))
 }
 
 // Reset resets the device.
-// Useful for cancelling timed-out operations.
+// Useful for cancelling timed-out operations,
+// so it doesn't wait for a running command.
 func (d *Device) Reset() error {
 	return d.send(esc('a'))
 }
 
-// Close resets and closes the USB device.
+// Close resets and closes the device's transport.
 func (d *Device) Close() error {
+	d.ledMu.Lock()
+	d.ledGen++ // stops retrying timers too
+	if d.ledTimer != nil {
+		d.ledTimer.Stop()
+	}
+	d.ledMu.Unlock()
 	err := d.Reset()
 	if err != nil {
 		return err
@@ -283,7 +432,7 @@ func (d *Device) Close() error {
 	return d.device.Close()
 }
 
-func NewDevice(d usb.Device) *Device {
+func NewDevice(d Transport) *Device {
 	return &Device{
 		device:       d,
 		PreSendDelay: 10 * time.Millisecond,
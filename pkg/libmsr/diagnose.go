@@ -0,0 +1,163 @@
+package libmsr
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const ledCycleDelay = 250 * time.Millisecond
+
+// Check is the outcome of a single diagnostic check.
+type Check struct {
+	Name     string
+	Err      error
+	Duration time.Duration
+	Skipped  bool
+}
+
+// Passed reports whether the check ran and succeeded.
+func (c *Check) Passed() bool {
+	return !c.Skipped && c.Err == nil
+}
+
+func (c *Check) String() string {
+	switch {
+	case c.Skipped:
+		return fmt.Sprintf("SKIP %s: %v", c.Name, c.Err)
+	case c.Err != nil:
+		return fmt.Sprintf("FAIL %s (%s): %v", c.Name, c.Duration, c.Err)
+	}
+	return fmt.Sprintf("PASS %s (%s)", c.Name, c.Duration)
+}
+
+// DiagnosticReport holds the results of Device.Diagnose.
+type DiagnosticReport struct {
+	Checks   []Check
+	Duration time.Duration
+}
+
+// Passed reports whether every check ran and succeeded,
+// so a report cut short by its context doesn't pass.
+func (r *DiagnosticReport) Passed() bool {
+	if len(r.Checks) == 0 {
+		return false
+	}
+	for i := range r.Checks {
+		if !r.Checks[i].Passed() {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *DiagnosticReport) String() string {
+	var b strings.Builder
+	for i := range r.Checks {
+		b.WriteString(r.Checks[i].String())
+		b.WriteByte('\n')
+	}
+	if r.Passed() {
+		b.WriteString("PASS")
+	} else {
+		b.WriteString("FAIL")
+	}
+	fmt.Fprintf(&b, " (%s)", r.Duration)
+	return b.String()
+}
+
+func (r *DiagnosticReport) run(ctx context.Context, name string, fn func() error) {
+	c := Check{Name: name}
+	if err := ctx.Err(); err != nil {
+		c.Err, c.Skipped = err, true
+	} else {
+		start := time.Now()
+		c.Err = fn()
+		c.Duration = time.Since(start)
+	}
+	r.Checks = append(r.Checks, c)
+}
+
+func sleepCtx(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (d *Device) checkCoercivity() error {
+	wasHiCo, err := d.IsHiCo()
+	if err != nil {
+		return err
+	}
+	for _, hiCo := range []bool{true, false} {
+		if hiCo {
+			err = d.SetHiCo()
+		} else {
+			err = d.SetLoCo()
+		}
+		if err != nil {
+			return err
+		}
+		isHiCo, err := d.IsHiCo()
+		if err != nil {
+			return err
+		}
+		if isHiCo != hiCo {
+			return fmt.Errorf("libmsr.Device.Diagnose: set hi-co %t, got %t", hiCo, isHiCo)
+		}
+	}
+	if wasHiCo {
+		return d.SetHiCo()
+	}
+	return nil // already lo-co
+}
+
+func (d *Device) checkDensity() error {
+	err := d.SetBitsPerInch(210, 75, 210)
+	if err != nil {
+		return err
+	}
+	return d.SetBitsPerChar(7, 5, 5)
+}
+
+func (d *Device) checkLEDs(ctx context.Context) error {
+	for _, m := range []LEDMode{LEDRedOn, LEDYellowOn, LEDGreenOn, LEDAllOn} {
+		if err := d.SetLED(m); err != nil {
+			return err
+		}
+		if err := sleepCtx(ctx, ledCycleDelay); err != nil {
+			d.SetLED(LEDAllOff)
+			return err
+		}
+	}
+	return d.SetLED(LEDAllOff)
+}
+
+// Diagnose runs every hardware self-test and returns a report of the results.
+// If testSensor is set, the card sensor is tested as well,
+// which requires a card to be swiped within d.SwipeTimeout.
+// Checks that have not started when ctx is done are skipped,
+// and the report doesn't pass.
+//
+// The coercivity is restored afterwards, but the BPI and BPC
+// are left at the ISO defaults (210/75/210 BPI, 7/5/5 BPC).
+func (d *Device) Diagnose(ctx context.Context, testSensor bool) *DiagnosticReport {
+	var r DiagnosticReport
+	start := time.Now()
+	r.run(ctx, "communication", d.TestCommunication)
+	r.run(ctx, "RAM", d.TestRAM)
+	if testSensor {
+		r.run(ctx, "sensor", d.TestSensor)
+	}
+	r.run(ctx, "coercivity", d.checkCoercivity)
+	r.run(ctx, "BPI/BPC", d.checkDensity)
+	r.run(ctx, "LEDs", func() error { return d.checkLEDs(ctx) })
+	r.Duration = time.Since(start)
+	return &r
+}
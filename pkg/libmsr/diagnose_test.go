@@ -0,0 +1,39 @@
+package libmsr
+
+import (
+	"context"
+	"testing"
+)
+
+func TestDiagnose(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	e.BPC = [3]byte{8, 8, 8}
+	d := NewDevice(e)
+	r := d.Diagnose(context.Background(), false)
+	if !r.Passed() {
+		t.Fatalf("diagnose failed:\n%s", r)
+	}
+	if bpc := d.Config().BPC; bpc != [3]int{7, 5, 5} {
+		t.Errorf("config BPC is %v, want [7 5 5]", bpc)
+	}
+	if e.BPC != [3]byte{7, 5, 5} {
+		t.Errorf("emulator BPC is %v, want [7 5 5]", e.BPC)
+	}
+}
+
+func TestDiagnoseCancelled(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	r := NewDevice(e).Diagnose(ctx, false)
+	if r.Passed() {
+		t.Errorf("cancelled diagnose passed:\n%s", r)
+	}
+	for _, c := range r.Checks {
+		if !c.Skipped {
+			t.Errorf("check %s ran after cancellation", c.Name)
+		}
+	}
+}
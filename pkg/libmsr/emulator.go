@@ -0,0 +1,214 @@
+package libmsr
+
+import (
+	"bytes"
+	"errors"
+	"sync"
+)
+
+// ErrEmulatorClosed is returned by a closed Emulator.
+var ErrEmulatorClosed = errors.New("libmsr: emulator closed")
+
+// Emulator is an in-memory Transport behaving like an MSR605X,
+// for use without hardware, such as in tests.
+// Swipes complete immediately on an emulated card.
+// ISO and raw data are stored separately and not converted between each other.
+// Raw tracks are stored as written (WritePacking),
+// and read back as by a device (ReadPacking).
+// Its exported fields should only be accessed while it is not in use.
+type Emulator struct {
+	mu           sync.Mutex
+	ISO          [3][]byte
+	Raw          [3][]byte
+	HiCo         bool
+	BPC          [3]byte
+	LeadingZeros [2]byte
+	LED          LEDMode
+	Model        byte
+	Firmware     string
+	msg          []byte
+	out          chan []byte
+	closed       chan struct{}
+}
+
+// NewEmulator returns an emulator with a blank card.
+func NewEmulator() *Emulator {
+	return &Emulator{
+		HiCo:         true,
+		BPC:          [3]byte{7, 5, 5},
+		LeadingZeros: [2]byte{61, 22},
+		Model:        '3',
+		Firmware:     "REV0EMU",
+		out:          make(chan []byte, 64),
+		closed:       make(chan struct{}),
+	}
+}
+
+func (e *Emulator) Read(b []byte) (int, error) {
+	select {
+	case <-e.closed:
+		return 0, ErrEmulatorClosed
+	case pkt := <-e.out:
+		return copy(b, pkt), nil
+	}
+}
+
+func (e *Emulator) Write(b []byte) (int, error) {
+	select {
+	case <-e.closed:
+		return 0, ErrEmulatorClosed
+	default:
+	}
+	if len(b) < 1 {
+		return 0, nil
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if b[0]&seqStartBit == seqStartBit {
+		e.msg = e.msg[:0]
+	}
+	n := int(b[0] & 63)
+	if n > len(b)-1 {
+		n = len(b) - 1
+	}
+	e.msg = append(e.msg, b[1:1+n]...)
+	if b[0]&seqEndBit == seqEndBit {
+		if resp := e.handle(e.msg); resp != nil {
+			for _, pkt := range makePackets(resp) {
+				e.out <- pkt
+			}
+		}
+	}
+	return len(b), nil
+}
+
+func (e *Emulator) Close() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	select {
+	case <-e.closed:
+		return ErrEmulatorClosed
+	default:
+		close(e.closed)
+	}
+	return nil
+}
+
+func withStatus(s Status, data ...byte) []byte {
+	return append(data, escByte, byte(s))
+}
+
+// parseTracks parses a write data block,
+// with a length before each track if raw is set.
+// Tracks not in the block are nil.
+func parseTracks(data []byte, raw bool) (tracks [3][]byte, ok bool) {
+	if !bytes.HasPrefix(data, esc('s')) || !bytes.HasSuffix(data, []byte{'?', fsByte}) {
+		return
+	}
+	data = data[2 : len(data)-2]
+	for len(data) > 0 {
+		if len(data) < 2 || data[0] != escByte || data[1] < 1 || data[1] > 3 {
+			return
+		}
+		i := data[1] - 1
+		data = data[2:]
+		var t []byte
+		if raw {
+			if len(data) < 1 || int(data[0]) > len(data)-1 {
+				return
+			}
+			t, data = data[1:1+data[0]], data[1+data[0]:]
+		} else {
+			end := bytes.IndexByte(data, escByte)
+			if end < 0 {
+				end = len(data)
+			}
+			t, data = data[:end], data[end:]
+		}
+		tracks[i] = append([]byte{}, t...)
+	}
+	return tracks, true
+}
+
+func (e *Emulator) handle(msg []byte) []byte {
+	if len(msg) < 2 || msg[0] != escByte {
+		return withStatus(StatusInvalidCommandFmt)
+	}
+	switch cmd := msg[1]; cmd {
+	case 'a':
+		return nil
+	case 'e':
+		return esc('y')
+	case 0x86, 0x87, 'b':
+		return withStatus(StatusOK)
+	case 0x81, 0x82, 0x83, 0x84, 0x85:
+		e.LED = LEDMode(cmd - 0x81)
+		return nil
+	case 'x', 'y':
+		e.HiCo = cmd == 'y'
+		return withStatus(StatusOK)
+	case 'd':
+		if e.HiCo {
+			return esc('h')
+		}
+		return esc('l')
+	case 'o':
+		if len(msg) != 5 {
+			return withStatus(StatusInvalidCommandFmt)
+		}
+		copy(e.BPC[:], msg[2:])
+		return append(esc(byte(StatusOK)), e.BPC[:]...)
+	case 'z':
+		if len(msg) != 4 {
+			return withStatus(StatusInvalidCommandFmt)
+		}
+		copy(e.LeadingZeros[:], msg[2:])
+		return withStatus(StatusOK)
+	case 'l':
+		return esc(e.LeadingZeros[:]...)
+	case 'c':
+		if len(msg) != 3 {
+			return withStatus(StatusInvalidCommandFmt)
+		}
+		for i := range e.Raw {
+			if msg[2]&(1<<i) != 0 {
+				e.ISO[i], e.Raw[i] = nil, nil
+			}
+		}
+		return withStatus(StatusOK)
+	case 'w', 'n':
+		tracks, ok := parseTracks(msg[2:], cmd == 'n')
+		if !ok {
+			return withStatus(StatusInvalidCommandFmt)
+		}
+		for i, t := range tracks {
+			if t == nil {
+				continue
+			}
+			if cmd == 'n' {
+				e.Raw[i] = t
+			} else {
+				e.ISO[i] = t
+			}
+		}
+		return withStatus(StatusOK)
+	case 'r':
+		data := esc('s')
+		for i, t := range e.ISO {
+			data = append(append(data, escByte, byte(i+1)), t...)
+		}
+		return withStatus(StatusOK, append(data, '?', fsByte)...)
+	case 'm':
+		data := esc('s')
+		for i, t := range e.Raw {
+			t = ReadPacking.Pack(WritePacking.Unpack(t))
+			data = append(append(data, escByte, byte(i+1), byte(len(t))), t...)
+		}
+		return withStatus(StatusOK, append(data, '?', fsByte)...)
+	case 't':
+		return esc(e.Model, 'S')
+	case 'v':
+		return append(esc(), e.Firmware...)
+	}
+	return withStatus(StatusInvalidCommand)
+}
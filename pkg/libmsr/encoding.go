@@ -1,93 +1,165 @@
 package libmsr
 
-func DecodeRaw(raw []byte, offset byte, bpcRaw, bpcChars int, parityEven bool) (chars []byte, parityOK []bool, lrcOK bool) {
-	chars, parityOK = make([]byte, 0), make([]bool, 0)
-	if len(raw) < 1 {
-		lrcOK = true
-		return
+import (
+	"bytes"
+	"errors"
+	"fmt"
+)
+
+// Parity is the parity of each character on a track.
+type Parity int
+
+const (
+	ParityOdd Parity = iota
+	ParityEven
+	ParityNone // no parity bit
+)
+
+// TrackFormat describes how characters are encoded on a track.
+type TrackFormat struct {
+	Name        string
+	BitsPerChar int      // including the parity bit, up to 8 data bits
+	CharOffset  byte     // added to each character's code
+	Charset     *Charset // used instead of CharOffset if set
+	Parity      Parity
+	BitsPerInch int
+	StartSentinel,
+	EndSentinel byte
+	MaxLen int // max characters, including sentinels and LRC
+}
+
+var (
+	ISOTrack1 = TrackFormat{
+		Name:          "ISO 7811 track 1",
+		BitsPerChar:   7,
+		CharOffset:    ' ',
+		BitsPerInch:   210,
+		StartSentinel: '%',
+		EndSentinel:   '?',
+		MaxLen:        79,
+	}
+	ISOTrack2 = TrackFormat{
+		Name:          "ISO 7811 track 2",
+		BitsPerChar:   5,
+		CharOffset:    '0',
+		BitsPerInch:   75,
+		StartSentinel: ';',
+		EndSentinel:   '?',
+		MaxLen:        40,
+	}
+	ISOTrack3 = TrackFormat{
+		Name:          "ISO 7811 track 3",
+		BitsPerChar:   5,
+		CharOffset:    '0',
+		BitsPerInch:   210,
+		StartSentinel: ';',
+		EndSentinel:   '?',
+		MaxLen:        107,
+	}
+	AAMVATrack3 = TrackFormat{
+		Name:          "AAMVA track 3",
+		BitsPerChar:   7,
+		CharOffset:    ' ',
+		BitsPerInch:   210,
+		StartSentinel: '%',
+		EndSentinel:   '?',
+		MaxLen:        79,
+	}
+	JISII = TrackFormat{
+		Name:          "JIS II",
+		BitsPerChar:   8,
+		BitsPerInch:   210,
+		StartSentinel: 0x7F,
+		EndSentinel:   0x7F,
+		MaxLen:        69,
 	}
-	remCount := 0
-	var remBits uint16
-	var lrc byte
-	lastNonNull := -1
-	for _, b := range raw {
-		remCount += bpcChars
-		remBits <<= bpcChars
-		remBits |= uint16(b) & ((0x01 << bpcChars) - 1)
-		for remCount >= bpcRaw {
-			remCount -= bpcRaw
-			i := byte(remBits >> remCount)
-			remBits &= (0x01 << remCount) - 1
 
-			p := i & 0x01
-			var c byte
-			for j := bpcRaw - 1; j > 0; j-- {
-				i >>= 1
-				p ^= i & 0x01
-				c |= (i & 0x01) << (j - 1)
-			}
-			if c != 0x00 {
-				lastNonNull = len(chars)
-			}
-			lrc ^= c
-			c += offset
-			/*
-				switch c {
-				case ',':
-					c = '`'
-				case '-':
-					c = ','
-				}
-			*/
-			chars = append(chars, c)
-			parityOK = append(parityOK, parityEven != (p&0x01 == 0x01))
+	ISOFormats   = [3]TrackFormat{ISOTrack1, ISOTrack2, ISOTrack3}
+	AAMVAFormats = [3]TrackFormat{ISOTrack1, ISOTrack2, AAMVATrack3}
+)
 
-		}
+// NewTrackFormat returns a format with the ISO 7811 character offset
+// and sentinels for the given bits per char (including parity).
+func NewTrackFormat(bpc int, parity Parity, bpi int) TrackFormat {
+	f := TrackFormat{
+		Name:        fmt.Sprintf("%d BPC", bpc),
+		BitsPerChar: bpc,
+		Parity:      parity,
+		BitsPerInch: bpi,
+	}
+	switch {
+	case bpc <= 5:
+		f.CharOffset, f.StartSentinel, f.EndSentinel = '0', ';', '?'
+	case bpc <= 7:
+		f.CharOffset, f.StartSentinel, f.EndSentinel = ' ', '%', '?'
+	default:
+		f.StartSentinel, f.EndSentinel = JISII.StartSentinel, JISII.EndSentinel
 	}
-	chars, parityOK = chars[:lastNonNull], parityOK[:lastNonNull]
-	lrcOK = lrc == 0
-	return
+	return f
 }
 
-func EncodeRaw(chars []byte, offset byte, bpcRaw, bpcChars int, parityEven bool) []byte {
-	raw := make([]byte, 0)
-	remCount := 0
-	var remBits uint16
-	var lrc byte
+// DecodeTrack decodes raw data from Device.ReadRawTracks in format f,
+// starting at the start sentinel if there is one.
+// Cards swiped backwards are detected and decoded in reverse.
+func DecodeTrack(raw []byte, f TrackFormat) (chars []byte, parityOK []bool, lrcOK bool) {
+	return DecodeTrackResult(raw, f).values()
+}
+
+// EncodeTrack encodes chars in format f, followed by an LRC,
+// for Device.WriteRawTracks.
+// Returns a *CapacityError if they don't fit on a track
+// after leadingZeros bits (see Capacity).
+func EncodeTrack(chars []byte, f TrackFormat, leadingZeros int) ([]byte, error) {
+	return EncodePacked(chars, WritePacking, f, leadingZeros)
+}
+
+// EncodePacked is like EncodeTrack, but packs the data as p.
+func EncodePacked(chars []byte, p Packing, f TrackFormat, leadingZeros int) ([]byte, error) {
+	if !p.valid() {
+		return nil, errors.New("libmsr.EncodePacked: invalid packing")
+	}
+	if n, max := DataLen(chars, f), Capacity(f, leadingZeros); max >= 0 && n > max {
+		return nil, &CapacityError{Len: n, Max: max}
+	}
 	for _, c := range chars {
-		/*
-			switch c {
-			case ',':
-				c = '-'
-			case '`':
-				c = ','
-			}
-		*/
-		c -= offset
-		lrc ^= c
-		for i := 0; i < bpcRaw-1; i++ {
-			c ^= ((c >> i) & 0x01) << (bpcRaw - 1)
-		}
-		remBits |= uint16(c) << remCount
-		remCount += bpcRaw
-		if remCount >= bpcChars {
-			raw = append(raw, byte(remBits)&((0x01<<bpcChars)-1))
-			remBits >>= bpcChars
-			remCount -= bpcChars
+		if _, ok := f.code(c); !ok {
+			return nil, fmt.Errorf("libmsr.EncodePacked: %q not in %s", c, f.Name)
 		}
 	}
-	for i := 0; i < bpcRaw-1; i++ {
-		lrc ^= ((lrc >> i) & 0x01) << (bpcRaw - 1)
-	}
-	remBits |= uint16(lrc) << remCount
-	remCount += bpcRaw
-	if remCount >= bpcChars {
-		raw = append(raw, byte(remBits)&((0x01<<bpcChars)-1))
-		remBits >>= bpcChars
-		remCount -= bpcChars
+	return encodeChars(chars, f, p), nil
+}
+
+// DecodeRaw decodes raw data with bpcRaw bits per char (including parity),
+// using the lower bpcChars bits of each byte, most significant first like reads.
+// It doesn't undo EncodeRaw, which packs like writes; use DecodePacked for that.
+// Chars hold at most 8 data bits; use DecodeCodes for wider ones.
+func DecodeRaw(raw []byte, offset byte, bpcRaw, bpcChars int, parityEven bool) (chars []byte, parityOK []bool, lrcOK bool) {
+	d := NewDecoder(bytes.NewReader(raw), rawFormat(offset, bpcRaw, parityEven), Packing{BitsPerByte: bpcChars})
+	return decodeStream(d).values()
+}
+
+// EncodeRaw encodes chars with bpcRaw bits per char (including parity),
+// into the lower bpcChars bits of each byte, least significant first like writes.
+// Chars hold at most 8 data bits; use EncodeCodes for wider ones.
+func EncodeRaw(chars []byte, offset byte, bpcRaw, bpcChars int, parityEven bool) []byte {
+	return encodeChars(chars, rawFormat(offset, bpcRaw, parityEven), Packing{BitsPerByte: bpcChars, LSBFirst: true})
+}
+
+func rawFormat(offset byte, bpcRaw int, parityEven bool) TrackFormat {
+	f := TrackFormat{BitsPerChar: bpcRaw, CharOffset: offset}
+	if parityEven {
+		f.Parity = ParityEven
 	}
-	if remCount > 0 {
-		raw = append(raw, byte(remBits))
+	return f
+}
+
+func encodeChars(chars []byte, f TrackFormat, p Packing) []byte {
+	var buf bytes.Buffer
+	e := NewEncoder(&buf, f, p)
+	for _, c := range chars {
+		code, _ := f.code(c) // masked to the data bits
+		e.writeCode(uint16(code))
 	}
-	return raw
+	e.Close()
+	return buf.Bytes()
 }
@@ -0,0 +1,107 @@
+// Package f2f decodes F2F (Aiken bi-phase) data from audio recordings
+// of a magnetic head, such as from audio jack readers.
+package f2f
+
+import (
+	"math"
+
+	"github.com/egginabucket/openmsr/pkg/libmsr"
+)
+
+// Decoder finds the flux transitions in a recording and recovers its bits.
+type Decoder struct {
+	// Threshold is the fraction of the loudest peak
+	// that other peaks must reach to count as transitions.
+	Threshold float64
+	// Adapt is how much each bit's length moves the clock,
+	// from 0 (fixed clock) to 1.
+	Adapt float64
+}
+
+// NewDecoder returns a decoder with the default settings.
+func NewDecoder() *Decoder {
+	return &Decoder{Threshold: 0.3, Adapt: 0.25}
+}
+
+// peaks returns the positions of the flux transitions:
+// the loudest sample of each run above the threshold,
+// alternating in polarity.
+func (d *Decoder) peaks(samples []float64) []int {
+	var mean, max float64
+	for _, s := range samples {
+		mean += s
+	}
+	mean /= float64(len(samples))
+	for _, s := range samples {
+		max = math.Max(max, math.Abs(s-mean))
+	}
+	thresh := d.Threshold * max
+	peaks := make([]int, 0)
+	var sign, peak float64 // of the last peak
+	for i, s := range samples {
+		s -= mean
+		if math.Abs(s) < thresh {
+			continue
+		}
+		switch {
+		case math.Signbit(s) != math.Signbit(sign) || len(peaks) == 0:
+			peaks = append(peaks, i)
+			sign, peak = s, s
+		case math.Abs(s) > math.Abs(peak):
+			peaks[len(peaks)-1] = i
+			peak = s
+		}
+	}
+	return peaks
+}
+
+// Bits returns the bits in a recording, one per byte, in swipe order.
+// The clock is taken from the leading zeros, then follows the swipe speed.
+func (d *Decoder) Bits(samples []float64) []byte {
+	peaks := d.peaks(samples)
+	if len(peaks) < 2 {
+		return nil
+	}
+	intervals := make([]float64, len(peaks)-1)
+	for i := range intervals {
+		intervals[i] = float64(peaks[i+1] - peaks[i])
+	}
+	// the first intervals after the swipe starts are leading zeros
+	n := len(intervals)
+	if n > 8 {
+		n = 8
+	}
+	var period float64
+	for _, iv := range intervals[1:n] {
+		period += iv
+	}
+	if n > 1 {
+		period /= float64(n - 1)
+	} else {
+		period = intervals[0]
+	}
+	bits := make([]byte, 0, len(intervals))
+	for i := 0; i < len(intervals); i++ {
+		bitLen := intervals[i]
+		if bitLen < 0.75*period {
+			// a one: two half bit intervals
+			bits = append(bits, 1)
+			if i+1 < len(intervals) && intervals[i+1] < 0.75*period {
+				i++
+				bitLen += intervals[i]
+			} else {
+				bitLen *= 2
+			}
+		} else {
+			bits = append(bits, 0)
+		}
+		period += d.Adapt * (bitLen - period)
+	}
+	return bits
+}
+
+// Decode returns the bits in a recording, with the default settings,
+// packed for libmsr.DecodeTrack and libmsr.DecodeFrame.
+func Decode(samples []float64) libmsr.RawTrack {
+	return libmsr.RawTrackFromBits(NewDecoder().Bits(samples))
+}
@@ -0,0 +1,120 @@
+package f2f
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/egginabucket/openmsr/pkg/libmsr"
+)
+
+const testTrack2 = ";4111111111111111=2705101?"
+
+// trackBits returns the bits of testTrack2 as written on a card,
+// after 22 leading zeros and followed by trailing zeros.
+func trackBits() []byte {
+	raw, err := libmsr.EncodeTrack([]byte(testTrack2), libmsr.ISOTrack2, 22)
+	if err != nil {
+		panic(err)
+	}
+	bits := append(make([]byte, 22), libmsr.WritePacking.Unpack(raw)...)
+	return append(bits, make([]byte, 22)...)
+}
+
+// record returns the signal of a head reading bits in F2F,
+// a pulse of alternating polarity at each flux transition.
+// Each bit takes period samples, times speedUp for every bit read.
+func record(bits []byte, period, speedUp float64) []float64 {
+	var transitions []float64
+	pos := 2 * period
+	for _, b := range bits {
+		transitions = append(transitions, pos)
+		if b == 1 {
+			transitions = append(transitions, pos+period/2)
+		}
+		pos += period
+		period *= speedUp
+	}
+	transitions = append(transitions, pos)
+	samples := make([]float64, int(pos+2*period))
+	width := period / 8
+	for i, t := range transitions {
+		sign := 1.0
+		if i%2 == 1 {
+			sign = -1
+		}
+		for j := int(t - 3*width); j <= int(t+3*width); j++ {
+			if j >= 0 && j < len(samples) {
+				d := (float64(j) - t) / width
+				samples[j] += sign * 0.8 * math.Exp(-d*d/2)
+			}
+		}
+	}
+	return samples
+}
+
+// wav encodes samples as a mono 16-bit WAV file,
+// with the given data chunk size if it isn't 0.
+func wav(samples []float64, rate int, dataSize uint32) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, s := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(int16(s*math.MaxInt16)))
+	}
+	if dataSize == 0 {
+		dataSize = uint32(len(data))
+	}
+	var b bytes.Buffer
+	le := func(v any) { binary.Write(&b, binary.LittleEndian, v) }
+	b.WriteString("RIFF")
+	le(uint32(4 + 8 + 16 + 8 + len(data)))
+	b.WriteString("WAVEfmt ")
+	le(uint32(16))
+	le([]uint16{1, 1}) // PCM, mono
+	le([]uint32{uint32(rate), uint32(2 * rate)})
+	le([]uint16{2, 16}) // block align, bits per sample
+	b.WriteString("data")
+	le(dataSize)
+	b.Write(data)
+	return b.Bytes()
+}
+
+func TestDecodeWAV(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		period, speedUp float64
+		dataSize        uint32
+	}{
+		{"steady", 40, 1, 0},
+		{"speeding up", 60, 0.995, 0},
+		{"slowing down", 20, 1.005, 0},
+		{"streamed", 40, 1, 0xFFFFFFFF},
+	} {
+		samples := record(trackBits(), tc.period, tc.speedUp)
+		a, err := ReadWAV(bytes.NewReader(wav(samples, 44100, tc.dataSize)))
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if a.SampleRate != 44100 || len(a.Samples) != len(samples) {
+			t.Fatalf("%s: read %d samples at %d Hz, want %d at 44100 Hz",
+				tc.name, len(a.Samples), a.SampleRate, len(samples))
+		}
+		fr, err := libmsr.DecodeFrame(Decode(a.Samples), libmsr.ISOTrack2)
+		if err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+		if want := testTrack2[1 : len(testTrack2)-1]; string(fr.Data) != want || !fr.LRCOK {
+			t.Errorf("%s: decoded %q (LRC ok %v), want %q", tc.name, fr.Data, fr.LRCOK, want)
+		}
+	}
+}
+
+func TestReadWAVTruncated(t *testing.T) {
+	b := wav(make([]float64, 100), 8000, 0)
+	if _, err := ReadWAV(bytes.NewReader(b[:30])); err == nil {
+		t.Error("no error for a truncated fmt chunk")
+	}
+	if _, err := ReadWAV(bytes.NewReader(b[:12])); err == nil {
+		t.Error("no error without chunks")
+	}
+}
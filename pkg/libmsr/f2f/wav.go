@@ -0,0 +1,114 @@
+package f2f
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Audio is a mono recording.
+type Audio struct {
+	SampleRate int
+	Samples    []float64 // from -1 to 1
+}
+
+const (
+	wavePCM        = 1
+	waveFloat      = 3
+	waveExtensible = 0xFFFE
+)
+
+// ReadWAV reads a WAV file of integer PCM (8 to 32 bits) or 32-bit float samples.
+// Only the first channel is kept.
+func ReadWAV(r io.Reader) (*Audio, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, err
+	}
+	if string(riff[:4]) != "RIFF" || string(riff[8:]) != "WAVE" {
+		return nil, errors.New("f2f.ReadWAV: not a WAV file")
+	}
+	var format, channels, bitsPerSample int
+	a := &Audio{}
+	for {
+		var hdr [8]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			if err == io.EOF {
+				err = errors.New("f2f.ReadWAV: no data chunk")
+			}
+			return nil, err
+		}
+		size := int64(binary.LittleEndian.Uint32(hdr[4:]))
+		switch string(hdr[:4]) {
+		case "fmt ":
+			b, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				return nil, err
+			}
+			if int64(len(b)) < size {
+				return nil, io.ErrUnexpectedEOF
+			}
+			if len(b) < 16 {
+				return nil, errors.New("f2f.ReadWAV: short fmt chunk")
+			}
+			format = int(binary.LittleEndian.Uint16(b))
+			channels = int(binary.LittleEndian.Uint16(b[2:]))
+			a.SampleRate = int(binary.LittleEndian.Uint32(b[4:]))
+			bitsPerSample = int(binary.LittleEndian.Uint16(b[14:]))
+			if format == waveExtensible && len(b) >= 26 {
+				format = int(binary.LittleEndian.Uint16(b[24:])) // sub format
+			}
+		case "data":
+			if channels == 0 {
+				return nil, errors.New("f2f.ReadWAV: data before fmt chunk")
+			}
+			// the size may be wrong, eg. 0xFFFFFFFF when streamed,
+			// so it only limits the read
+			b, err := io.ReadAll(io.LimitReader(r, size))
+			if err != nil {
+				return nil, err
+			}
+			a.Samples, err = samples(b, format, channels, bitsPerSample)
+			return a, err
+		default:
+			if _, err := io.CopyN(io.Discard, r, size); err != nil {
+				return nil, err
+			}
+		}
+		if size%2 == 1 { // chunks are word aligned
+			if _, err := io.CopyN(io.Discard, r, 1); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// samples decodes the first channel of PCM data.
+func samples(b []byte, format, channels, bitsPerSample int) ([]float64, error) {
+	size := bitsPerSample / 8
+	if bitsPerSample%8 != 0 || size < 1 || size > 4 ||
+		format == waveFloat && size != 4 || format != wavePCM && format != waveFloat {
+		return nil, fmt.Errorf("f2f.ReadWAV: unsupported format %d with %d bits per sample", format, bitsPerSample)
+	}
+	frame := size * channels
+	s := make([]float64, len(b)/frame)
+	for i := range s {
+		p := b[i*frame : i*frame+size]
+		switch {
+		case format == waveFloat:
+			s[i] = float64(math.Float32frombits(binary.LittleEndian.Uint32(p)))
+		case size == 1: // unsigned
+			s[i] = (float64(p[0]) - 128) / 128
+		default:
+			var v int32
+			for j := size - 1; j >= 0; j-- {
+				v = v<<8 | int32(p[j])
+			}
+			v <<= 32 - bitsPerSample // sign extend
+			s[i] = float64(v) / (1 << 31)
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,114 @@
+package libmsr
+
+import (
+	"errors"
+)
+
+// ErrNoStartSentinel is returned when a track has no start sentinel.
+var ErrNoStartSentinel = errors.New("libmsr: start sentinel not found")
+
+// Frame is a track split up as defined by ISO 7811:
+// leading zeros, start sentinel, data, end sentinel, LRC, and trailing zeros.
+type Frame struct {
+	Format TrackFormat
+	// Reversed is set if the card was swiped backwards,
+	// so the bits were decoded in reverse.
+	Reversed bool
+	// LeadingZeros is the number of zero bits right before the start sentinel,
+	// and LeadingJunk the number of bits before those.
+	LeadingZeros,
+	LeadingJunk int
+	Data     []byte // between the sentinels, without them
+	ParityOK []bool // for each of Data
+	HasEnd   bool   // whether the end sentinel was found
+	HasLRC   bool   // whether there was a character after the end sentinel
+	LRC      byte   // code of the LRC character, without parity
+	// LRCParityOK is true if the LRC character has valid parity.
+	LRCParityOK bool
+	// LRCOK is true if the LRC has valid parity
+	// and matches the sentinels and data.
+	LRCOK bool
+	// TrailingJunk is the number of bits after the LRC
+	// up to and including the last one bit.
+	TrailingJunk int
+}
+
+// Char is a character read from a bit stream.
+type Char struct {
+	Offset   int  // in bits
+	Code     byte // data bits, without parity; up to 8 (see DecodeCodes)
+	ParityOK bool
+	Value    byte // the character Code maps to in its format
+}
+
+// readChar reads the character at bit offset pos,
+// whose data bits come least significant first, followed by parity.
+func (f *TrackFormat) readChar(bits []byte, pos int) (Char, bool) {
+	if pos < 0 || pos+f.BitsPerChar > len(bits) {
+		return Char{}, false
+	}
+	code, parityOK := readCode(bits, pos, f.BitsPerChar, f.Parity)
+	c := Char{Offset: pos, Code: byte(code), ParityOK: parityOK}
+	c.Value = f.char(c.Code)
+	return c, true
+}
+
+// findStart returns the offset of the first start sentinel with valid parity,
+// or -1 if there is none.
+func (f *TrackFormat) findStart(bits []byte) int {
+	ss, ok := f.code(f.StartSentinel)
+	if !ok {
+		return -1
+	}
+	for pos := 0; pos+f.BitsPerChar <= len(bits); pos++ {
+		if c, _ := f.readChar(bits, pos); c.Code == ss && c.ParityOK {
+			return pos
+		}
+	}
+	return -1
+}
+
+// frame splits r up as a Frame, or returns ErrNoStartSentinel.
+func (r *DecodeResult) frame() (*Frame, error) {
+	if r.Start < 0 {
+		return nil, ErrNoStartSentinel
+	}
+	fr := Frame{
+		Format:   r.Format,
+		Reversed: r.Reversed,
+		Data:     r.Data(),
+		HasEnd:   r.End >= 0,
+	}
+	fr.LeadingZeros, fr.LeadingJunk, fr.TrailingJunk = r.junk()
+	decoded := r.Decoded()[r.Start+1:]
+	if fr.HasEnd {
+		decoded = decoded[:r.End-r.Start-1]
+	}
+	for _, c := range decoded {
+		fr.ParityOK = append(fr.ParityOK, c.ParityOK)
+	}
+	if fr.HasEnd && r.LRCIndex >= 0 {
+		c := r.Chars[r.LRCIndex]
+		fr.HasLRC = true
+		fr.LRC = c.Code
+		fr.LRCParityOK = c.ParityOK
+		fr.LRCOK = c.ParityOK && r.LRCOK
+	}
+	return &fr, nil
+}
+
+func reverseBits(bits []byte) []byte {
+	rev := make([]byte, len(bits))
+	for i, b := range bits {
+		rev[len(bits)-1-i] = b
+	}
+	return rev
+}
+
+// DecodeFrame decodes raw data from Device.ReadRawTracks in format f,
+// starting at the first start sentinel,
+// and validates the LRC over the start sentinel, data and end sentinel.
+// Cards swiped backwards are detected and decoded in reverse.
+func DecodeFrame(raw []byte, f TrackFormat) (*Frame, error) {
+	return DecodeTrackResult(raw, f).frame()
+}
@@ -0,0 +1,53 @@
+package libmsr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+func TestFrameMatchesResult(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, f := range ISOFormats {
+		for i := 0; i < 200; i++ {
+			bits := swipeBits(t, randomTrack(rnd, f, 30), f, rnd.Intn(30))
+			for n := rnd.Intn(3); n > 0; n-- {
+				bits[rnd.Intn(len(bits))] ^= 1
+			}
+			if rnd.Intn(2) == 0 {
+				bits = reverseBits(bits)
+			}
+			raw := RawTrackFromBits(bits)
+			r := DecodeTrackResult(raw, f)
+			fr, err := DecodeFrame(raw, f)
+			if err != nil {
+				if r.Start >= 0 {
+					t.Fatalf("%s: %v, but the result has a start sentinel", f.Name, err)
+				}
+				continue
+			}
+			if !bytes.Equal(fr.Data, r.Data()) || fr.Reversed != r.Reversed ||
+				fr.HasEnd != (r.End >= 0) || fr.LRCOK && !r.LRCOK {
+				t.Fatalf("%s: frame %+v doesn't match result %+v", f.Name, fr, r)
+			}
+		}
+	}
+}
+
+func TestFrameJunk(t *testing.T) {
+	f := ISOTrack2
+	bits := swipeBits(t, []byte(";123?"), f, 10)
+	bits = append([]byte{1, 0, 1}, bits...)
+	bits = append(bits, 0, 0, 1, 0)
+	fr, err := DecodeFrame(RawTrackFromBits(bits), f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fr.LeadingZeros != 10 || fr.LeadingJunk != 3 || fr.TrailingJunk == 0 {
+		t.Errorf("leading zeros %d, leading junk %d, trailing junk %d",
+			fr.LeadingZeros, fr.LeadingJunk, fr.TrailingJunk)
+	}
+	if string(fr.Data) != "123" || !fr.HasEnd || !fr.HasLRC || !fr.LRCOK || fr.Reversed {
+		t.Errorf("decoded %+v", fr)
+	}
+}
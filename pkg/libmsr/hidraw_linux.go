@@ -0,0 +1,134 @@
+package libmsr
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const sysHidraw = "/sys/class/hidraw"
+
+// HidrawInfo describes a Linux hidraw device node.
+type HidrawInfo struct {
+	Path      string // eg. /dev/hidraw0
+	VendorID  uint16
+	ProductID uint16
+	Product   string
+	Serial    string
+	Phys      string // physical location, eg. usb-0000:00:14.0-1/input0
+}
+
+// readHidrawUevent fills in info from the HID device's uevent file.
+func readHidrawUevent(path string, info *HidrawInfo) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		key, value, _ := strings.Cut(s.Text(), "=")
+		switch key {
+		case "HID_ID": // bus:vendor:product
+			var bus uint16
+			var vid, pid uint32
+			if _, err := fmt.Sscanf(value, "%x:%x:%x", &bus, &vid, &pid); err != nil {
+				return err
+			}
+			info.VendorID, info.ProductID = uint16(vid), uint16(pid)
+		case "HID_NAME":
+			info.Product = value
+		case "HID_UNIQ":
+			info.Serial = value
+		case "HID_PHYS":
+			info.Phys = value
+		}
+	}
+	return s.Err()
+}
+
+// EnumerateHidraw lists the hidraw devices with the given IDs,
+// using sysfs. An ID of 0 matches any device.
+func EnumerateHidraw(vendorID, productID uint16) ([]HidrawInfo, error) {
+	entries, err := os.ReadDir(sysHidraw)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]HidrawInfo, 0, 1)
+	for _, e := range entries {
+		info := HidrawInfo{Path: filepath.Join("/dev", e.Name())}
+		err := readHidrawUevent(filepath.Join(sysHidraw, e.Name(), "device", "uevent"), &info)
+		if err != nil {
+			continue // not a HID device we can identify
+		}
+		if (vendorID == 0 || info.VendorID == vendorID) &&
+			(productID == 0 || info.ProductID == productID) {
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// hidraw is a Transport using a hidraw device node.
+type hidraw struct {
+	f *os.File
+}
+
+func (h *hidraw) Read(b []byte) (int, error) {
+	return h.f.Read(b)
+}
+
+func (h *hidraw) Write(b []byte) (int, error) {
+	report := make([]byte, len(b)+1) // report ID 0, as the device has unnumbered reports
+	copy(report[1:], b)
+	n, err := h.f.Write(report)
+	if n > 0 {
+		n--
+	}
+	return n, err
+}
+
+func (h *hidraw) Close() error {
+	return h.f.Close()
+}
+
+// OpenHidraw opens a hidraw device node, such as HidrawInfo.Path, as a Transport.
+// It does not need cgo.
+func OpenHidraw(path string) (Transport, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &hidraw{f: f}, nil
+}
+
+// Open opens the device node as a Transport.
+func (info *HidrawInfo) Open() (Transport, error) {
+	if info.Path == "" {
+		return nil, errors.New("libmsr.HidrawInfo.Open: no path")
+	}
+	return OpenHidraw(info.Path)
+}
+
+// ReopenHidraw returns a function that finds the device described by info again
+// and opens it, for use as ResilientDevice.Reopen.
+// The device is matched by serial number if it has one,
+// else by its physical location.
+func ReopenHidraw(info HidrawInfo) func() (Transport, error) {
+	return func() (Transport, error) {
+		infos, err := EnumerateHidraw(info.VendorID, info.ProductID)
+		if err != nil {
+			return nil, err
+		}
+		for _, i := range infos {
+			if info.Serial != "" && i.Serial == info.Serial ||
+				info.Serial == "" && i.Phys == info.Phys {
+				return i.Open()
+			}
+		}
+		return nil, errors.New("libmsr.ReopenHidraw: device not found")
+	}
+}
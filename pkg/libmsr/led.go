@@ -0,0 +1,103 @@
+package libmsr
+
+import (
+	"errors"
+	"time"
+)
+
+// Operation is a kind of swipe operation.
+type Operation int
+
+const (
+	OpRead Operation = iota
+	OpWrite
+	OpErase
+)
+
+// LEDPolicy drives the device's LEDs automatically during swipe operations:
+// yellow while waiting for a swipe, green after success,
+// red after a Status error, and all off when idle.
+type LEDPolicy struct {
+	// Operations selects which operations give LED feedback.
+	Operations map[Operation]bool
+	// SuccessHold and FailureHold are how long the green and red LEDs
+	// stay on after an operation. Zero keeps them on until the next operation.
+	SuccessHold,
+	FailureHold time.Duration
+}
+
+// NewLEDPolicy returns a policy giving feedback for all operations.
+func NewLEDPolicy() *LEDPolicy {
+	return &LEDPolicy{
+		Operations: map[Operation]bool{
+			OpRead:  true,
+			OpWrite: true,
+			OpErase: true,
+		},
+		SuccessHold: time.Second,
+		FailureHold: 3 * time.Second,
+	}
+}
+
+// ledRetryDelay is how long an LED timer waits for a running command.
+const ledRetryDelay = 50 * time.Millisecond
+
+// setPolicyLED sets the LEDs to mode, turning them off after hold.
+// LED errors are ignored as feedback is best-effort.
+func (d *Device) setPolicyLED(mode LEDMode, hold time.Duration) {
+	d.cmdMu.Lock()
+	defer d.cmdMu.Unlock()
+	d.ledMu.Lock()
+	defer d.ledMu.Unlock()
+	d.ledGen++
+	if d.ledTimer != nil {
+		d.ledTimer.Stop()
+	}
+	d.setLED(mode)
+	if hold > 0 {
+		d.ledTimer = time.AfterFunc(hold, d.ledOff(d.ledGen))
+	}
+}
+
+// ledOff returns a timer func turning the LEDs off unless an operation
+// started since generation gen. While a command is running it tries again
+// later, so the write can't land in the middle of the command.
+func (d *Device) ledOff(gen int) func() {
+	var off func()
+	off = func() {
+		if !d.cmdMu.TryLock() {
+			d.ledMu.Lock()
+			if d.ledGen == gen {
+				d.ledTimer = time.AfterFunc(ledRetryDelay, off)
+			}
+			d.ledMu.Unlock()
+			return
+		}
+		defer d.cmdMu.Unlock()
+		d.ledMu.Lock()
+		defer d.ledMu.Unlock()
+		if d.ledGen == gen {
+			d.setLED(LEDAllOff)
+		}
+	}
+	return off
+}
+
+func (d *Device) withLED(op Operation, fn func() error) error {
+	p := d.LEDPolicy
+	if p == nil || !p.Operations[op] {
+		return fn()
+	}
+	d.setPolicyLED(LEDYellowOn, 0)
+	err := fn()
+	var status Status
+	switch {
+	case err == nil:
+		d.setPolicyLED(LEDGreenOn, p.SuccessHold)
+	case errors.As(err, &status):
+		d.setPolicyLED(LEDRedOn, p.FailureHold)
+	default:
+		d.setPolicyLED(LEDAllOff, 0)
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package libmsr
+
+import (
+	"testing"
+	"time"
+)
+
+func emulatorLED(e *Emulator) LEDMode {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.LED
+}
+
+// waitLED waits up to a second for the emulator's LEDs to be set to mode.
+func waitLED(t *testing.T, e *Emulator, mode LEDMode) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if emulatorLED(e) == mode {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("LED mode is %d, want %d", emulatorLED(e), mode)
+}
+
+func newLEDTestDevice(hold time.Duration) (*Device, *Emulator) {
+	e := NewEmulator()
+	d := NewDevice(e)
+	d.LEDPolicy = NewLEDPolicy()
+	d.LEDPolicy.SuccessHold = hold
+	return d, e
+}
+
+func TestLEDPolicy(t *testing.T) {
+	d, e := newLEDTestDevice(50 * time.Millisecond)
+	defer e.Close()
+	if _, err := d.ReadISOTracks(); err != nil {
+		t.Fatal(err)
+	}
+	if m := emulatorLED(e); m != LEDGreenOn {
+		t.Fatalf("LED mode is %d after reading, want green", m)
+	}
+	waitLED(t, e, LEDAllOff)
+}
+
+func TestLEDPolicyWaitsForCommand(t *testing.T) {
+	d, e := newLEDTestDevice(20 * time.Millisecond)
+	defer e.Close()
+	if _, err := d.ReadISOTracks(); err != nil {
+		t.Fatal(err)
+	}
+	d.cmdMu.Lock() // as if a command were running past the hold
+	time.Sleep(100 * time.Millisecond)
+	m := emulatorLED(e)
+	d.cmdMu.Unlock()
+	if m != LEDGreenOn {
+		t.Fatalf("LED mode is %d while a command is running, want green", m)
+	}
+	waitLED(t, e, LEDAllOff)
+}
+
+func TestLEDPolicyNoHold(t *testing.T) {
+	d, e := newLEDTestDevice(0)
+	defer e.Close()
+	if _, err := d.ReadISOTracks(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if m := emulatorLED(e); m != LEDGreenOn {
+		t.Errorf("LED mode is %d with no hold, want green", m)
+	}
+}
@@ -12,6 +12,8 @@ const (
 	fsByte      byte = 0x1C
 )
 
+var errNoTracks = errors.New("libmsr: no tracks to write")
+
 func esc(data ...byte) []byte {
 	b := make([]byte, len(data)+1)
 	b[0] = escByte
@@ -31,7 +33,7 @@ func makePackets(msg []byte) [][]byte {
 			pkt[0] |= seqStartBit
 		}
 		if i == n-1 {
-			pkt[0] |= seqEndBit | byte(len(msg[i:]))
+			pkt[0] |= seqEndBit | byte(len(msg[i*63:]))
 		} else {
 			pkt[0] |= 63
 		}
@@ -71,29 +73,31 @@ func decode(msg []byte) (data, result []byte, err error) {
 	return
 }
 
-func encodeTrack(data []byte, num int) []byte {
+// encodeTrack encodes a track for a write data block.
+// Raw tracks are preceded by their length, ISO tracks are not.
+func encodeTrack(data []byte, num int, raw bool) []byte {
 	if num < 1 || num > 3 {
 		panic("invalid track")
 	}
-	return append(esc(byte(num), byte(len(data))), data...)
+	if raw {
+		return append(esc(byte(num), byte(len(data))), data...)
+	}
+	return append(esc(byte(num)), data...)
 }
 
-func encodeRawTracks(tracks ...[]byte) []byte {
+// encodeTracks encodes a write data block.
+// Empty tracks are left out so the device doesn't change them.
+func encodeTracks(raw bool, tracks ...[]byte) ([]byte, error) {
 	data := esc('s')
 	for i, t := range tracks {
-		if true || len(t) > 0 { // TODO
-			data = append(data, encodeTrack(t, i+1)...)
+		if len(t) > 0 {
+			data = append(data, encodeTrack(t, i+1, raw)...)
 		}
 	}
-	return append(data, '?', fsByte)
-}
-
-func encodeISOTracks(t1, t2, t3 []byte) []byte {
-	data := esc('s')
-	data = append(data, encodeTrack(t1, 1)...)
-	data = append(data, encodeTrack(t2, 2)...)
-	data = append(data, encodeTrack(t3, 3)...)
-	return append(data, '?', fsByte)
+	if len(data) == 2 {
+		return nil, errNoTracks
+	}
+	return append(data, '?', fsByte), nil
 }
 
 func decodeTracks(data []byte) ([3][]byte, error) {
@@ -0,0 +1,31 @@
+package libmsr
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPacketsRoundTrip(t *testing.T) {
+	for n := 1; n <= 4*63+1; n++ {
+		msg := make([]byte, n)
+		for i := range msg {
+			msg[i] = byte(i)
+		}
+		pkts := makePackets(msg)
+		for i, pkt := range pkts {
+			if len(pkt) != 64 {
+				t.Fatalf("%d bytes: packet %d is %d bytes, want 64", n, i, len(pkt))
+			}
+			if end := pkt[0]&seqEndBit != 0; end != (i == len(pkts)-1) {
+				t.Fatalf("%d bytes: packet %d of %d has end bit %v", n, i, len(pkts), end)
+			}
+		}
+		got, err := parsePackets(pkts)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !bytes.Equal(got, msg) {
+			t.Fatalf("%d bytes: parsed %d bytes back, want %v", n, len(got), msg)
+		}
+	}
+}
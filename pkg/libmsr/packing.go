@@ -0,0 +1,136 @@
+package libmsr
+
+import (
+	"errors"
+)
+
+// Packing describes how a bit stream is packed into bytes.
+type Packing struct {
+	BitsPerByte int  // the lower bits of each byte used, 1 to 8
+	LSBFirst    bool // whether the least significant of them comes first
+}
+
+var (
+	// ReadPacking is how Device.ReadRawTracks packs bits.
+	ReadPacking = Packing{BitsPerByte: 8}
+	// WritePacking is how Device.WriteRawTracks packs bits.
+	WritePacking = Packing{BitsPerByte: 8, LSBFirst: true}
+)
+
+// Unpack unpacks raw into one bit per byte, in stream order.
+func (p Packing) Unpack(raw []byte) []byte {
+	return p.unpackInto(make([]byte, 0, len(raw)*p.BitsPerByte), raw)
+}
+
+// unpackInto appends the unpacked bits of raw to bits.
+func (p Packing) unpackInto(bits []byte, raw []byte) []byte {
+	for _, b := range raw {
+		for i := 0; i < p.BitsPerByte; i++ {
+			j := p.BitsPerByte - 1 - i
+			if p.LSBFirst {
+				j = i
+			}
+			bits = append(bits, (b>>j)&0x01)
+		}
+	}
+	return bits
+}
+
+// Pack packs one bit per byte into raw bytes,
+// padding the last byte with zeros.
+func (p Packing) Pack(bits []byte) []byte {
+	raw := make([]byte, (len(bits)+p.BitsPerByte-1)/p.BitsPerByte)
+	for i, b := range bits {
+		j := p.BitsPerByte - 1 - i%p.BitsPerByte
+		if p.LSBFirst {
+			j = i % p.BitsPerByte
+		}
+		raw[i/p.BitsPerByte] |= (b & 0x01) << j
+	}
+	return raw
+}
+
+func (p Packing) valid() bool {
+	return p.BitsPerByte >= 1 && p.BitsPerByte <= 8
+}
+
+// dataBits returns the number of data bits in a char of bpc bits.
+func dataBits(bpc int, parity Parity) int {
+	if parity == ParityNone {
+		return bpc
+	}
+	return bpc - 1
+}
+
+// readCode reads the char of bpc bits at bit offset pos,
+// whose data bits come least significant first, followed by parity.
+func readCode(bits []byte, pos, bpc int, parity Parity) (code uint16, parityOK bool) {
+	n := dataBits(bpc, parity)
+	var p byte
+	for i, b := range bits[pos : pos+bpc] {
+		p ^= b
+		if i < n {
+			code |= uint16(b) << i
+		}
+	}
+	switch parity {
+	case ParityOdd:
+		return code, p == 0x01
+	case ParityEven:
+		return code, p == 0x00
+	}
+	return code, true
+}
+
+// appendCode appends the bits of code as a char of bpc bits.
+func appendCode(bits []byte, code uint16, bpc int, parity Parity) []byte {
+	n := dataBits(bpc, parity)
+	var p byte
+	for i := 0; i < n; i++ {
+		b := byte(code>>i) & 0x01
+		p ^= b
+		bits = append(bits, b)
+	}
+	switch parity {
+	case ParityOdd:
+		bits = append(bits, p^0x01)
+	case ParityEven:
+		bits = append(bits, p)
+	}
+	return bits
+}
+
+func validCodeFormat(p Packing, bpc int, parity Parity) bool {
+	return p.valid() && bpc <= 16 && dataBits(bpc, parity) >= 1
+}
+
+// DecodeCodes decodes every whole char of bpc bits (1 to 16, including parity)
+// from raw data packed as p.
+// Unlike DecodeRaw, it doesn't look for an LRC or trim nulls.
+func DecodeCodes(raw []byte, p Packing, bpc int, parity Parity) (codes []uint16, parityOK []bool, err error) {
+	if !validCodeFormat(p, bpc, parity) {
+		return nil, nil, errors.New("libmsr.DecodeCodes: invalid bits per char or packing")
+	}
+	bits := p.Unpack(raw)
+	n := len(bits) / bpc
+	codes, parityOK = make([]uint16, n), make([]bool, n)
+	for i := range codes {
+		codes[i], parityOK[i] = readCode(bits, i*bpc, bpc, parity)
+	}
+	return codes, parityOK, nil
+}
+
+// EncodeCodes encodes codes as chars of bpc bits (1 to 16, including parity),
+// packed as p. Data bits above those that fit are dropped.
+// DecodeCodes with the same arguments returns codes,
+// followed by null chars if the padding of the last byte holds any.
+func EncodeCodes(codes []uint16, p Packing, bpc int, parity Parity) ([]byte, error) {
+	if !validCodeFormat(p, bpc, parity) {
+		return nil, errors.New("libmsr.EncodeCodes: invalid bits per char or packing")
+	}
+	bits := make([]byte, 0, len(codes)*bpc)
+	for _, c := range codes {
+		bits = appendCode(bits, c, bpc, parity)
+	}
+	return p.Pack(bits), nil
+}
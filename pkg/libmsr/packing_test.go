@@ -0,0 +1,171 @@
+package libmsr
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+)
+
+var (
+	testParities = []Parity{ParityOdd, ParityEven, ParityNone}
+	testPackings = []Packing{
+		ReadPacking,
+		WritePacking,
+		{BitsPerByte: 1},
+		{BitsPerByte: 5, LSBFirst: true},
+		{BitsPerByte: 7},
+	}
+)
+
+func TestCodesRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, p := range testPackings {
+		for bpc := 1; bpc <= 16; bpc++ {
+			for _, parity := range testParities {
+				n := dataBits(bpc, parity)
+				if n < 1 {
+					if _, err := EncodeCodes(nil, p, bpc, parity); err == nil {
+						t.Errorf("%+v, %d bpc, parity %d: no error without data bits", p, bpc, parity)
+					}
+					continue
+				}
+				for i := 0; i < 20; i++ {
+					codes := make([]uint16, rnd.Intn(50))
+					for j := range codes {
+						codes[j] = uint16(rnd.Intn(1 << n))
+					}
+					raw, err := EncodeCodes(codes, p, bpc, parity)
+					if err != nil {
+						t.Fatal(err)
+					}
+					got, parityOK, err := DecodeCodes(raw, p, bpc, parity)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(got) < len(codes) {
+						t.Fatalf("%+v, %d bpc, parity %d: decoded %d codes, want %d", p, bpc, parity, len(got), len(codes))
+					}
+					for j, c := range got {
+						want := uint16(0) // padding
+						if j < len(codes) {
+							want = codes[j]
+						}
+						if c != want || j < len(codes) && !parityOK[j] {
+							t.Fatalf("%+v, %d bpc, parity %d: code %d is %d (parity ok %v), want %d",
+								p, bpc, parity, j, c, parityOK[j], want)
+						}
+					}
+				}
+			}
+		}
+	}
+}
+
+// randomTrack returns a start sentinel, up to max random data characters
+// and an end sentinel in format f.
+func randomTrack(rnd *rand.Rand, f TrackFormat, max int) []byte {
+	ss, _ := f.code(f.StartSentinel)
+	es, _ := f.code(f.EndSentinel)
+	chars := []byte{f.StartSentinel}
+	for n := rnd.Intn(max + 1); n > 0; {
+		code := byte(rnd.Intn(1 << dataBits(f.BitsPerChar, f.Parity)))
+		if code != ss && code != es {
+			chars = append(chars, f.char(code))
+			n--
+		}
+	}
+	return append(chars, f.EndSentinel)
+}
+
+func TestPackedRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for _, p := range testPackings {
+		for _, f := range ISOFormats {
+			for _, parity := range testParities {
+				f.Parity = parity
+				for i := 0; i < 20; i++ {
+					chars := randomTrack(rnd, f, Capacity(f, 0))
+					raw, err := EncodePacked(chars, p, f, 0)
+					if err != nil {
+						t.Fatal(err)
+					}
+					r := DecodePacked(raw, p, f)
+					if data := r.Data(); !bytes.Equal(data, chars[1:len(chars)-1]) || !r.LRCOK || r.ParityErrors > 0 {
+						t.Fatalf("%+v, %s, parity %d: decoded %q (LRC ok %v, %d parity errors), want %q",
+							p, f.Name, parity, data, r.LRCOK, r.ParityErrors, chars)
+					}
+				}
+			}
+		}
+	}
+}
+
+// TestEncodeRawRoundTrip checks that EncodeRaw packs like writes
+// for every width of char and byte it supports.
+func TestEncodeRawRoundTrip(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for bpcRaw := 2; bpcRaw <= 9; bpcRaw++ {
+		n := bpcRaw - 1 // data bits
+		offset := byte(0)
+		if n < 8 {
+			offset = byte(rnd.Intn(1 << 7))
+		}
+		for bpcChars := 1; bpcChars <= 8; bpcChars++ {
+			for _, even := range []bool{false, true} {
+				parity := ParityOdd
+				if even {
+					parity = ParityEven
+				}
+				for i := 0; i < 10; i++ {
+					chars := make([]byte, rnd.Intn(40))
+					var lrc uint16
+					for j := range chars {
+						code := rnd.Intn(1 << n)
+						chars[j] = offset + byte(code)
+						lrc ^= uint16(code)
+					}
+					raw := EncodeRaw(chars, offset, bpcRaw, bpcChars, even)
+					codes, parityOK, err := DecodeCodes(raw, Packing{bpcChars, true}, bpcRaw, parity)
+					if err != nil {
+						t.Fatal(err)
+					}
+					if len(codes) <= len(chars) {
+						t.Fatalf("%d/%d bpc: decoded %d codes, want %d and an LRC", bpcRaw, bpcChars, len(codes), len(chars))
+					}
+					for j, c := range chars {
+						if codes[j] != uint16(c-offset) || !parityOK[j] {
+							t.Fatalf("%d/%d bpc: code %d is %d (parity ok %v), want %d",
+								bpcRaw, bpcChars, j, codes[j], parityOK[j], c-offset)
+						}
+					}
+					if codes[len(chars)] != lrc || !parityOK[len(chars)] {
+						t.Fatalf("%d/%d bpc: LRC is %d, want %d", bpcRaw, bpcChars, codes[len(chars)], lrc)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestEncodeRawPacking(t *testing.T) {
+	chars := []byte(";1234=5678?")
+	raw := EncodeRaw(chars, '0', 5, 8, false)
+	codes, _, err := DecodeCodes(raw, WritePacking, 5, ParityOdd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var lrc uint16
+	for i, c := range chars {
+		if want := uint16(c - '0'); codes[i] != want {
+			t.Fatalf("code %d is %d, want %d", i, codes[i], want)
+		}
+		lrc ^= uint16(c - '0')
+	}
+	if codes[len(chars)] != lrc {
+		t.Errorf("LRC is %d, want %d", codes[len(chars)], lrc)
+	}
+	// DecodeRaw unpacks like reads, so it doesn't undo EncodeRaw.
+	if got, _, _ := DecodeRaw(raw, '0', 5, 8, false); bytes.Equal(got, chars) {
+		t.Errorf("DecodeRaw(EncodeRaw(%q)) round trips", chars)
+	}
+}
@@ -0,0 +1,335 @@
+package libmsr
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// JobState is the state of a job submitted to a Queue.
+type JobState int
+
+const (
+	JobQueued JobState = iota
+	JobRunning
+	JobWaitingForSwipe
+	JobDone
+	JobFailed
+	JobCancelled
+)
+
+func (s JobState) String() string {
+	switch s {
+	case JobQueued:
+		return "queued"
+	case JobRunning:
+		return "running"
+	case JobWaitingForSwipe:
+		return "waiting for swipe"
+	case JobDone:
+		return "done"
+	case JobFailed:
+		return "failed"
+	case JobCancelled:
+		return "cancelled"
+	}
+	return "unknown"
+}
+
+// ErrJobCancelled is returned by Handle.Wait for cancelled jobs.
+var ErrJobCancelled = errors.New("libmsr: job cancelled")
+
+// Job is an operation run on a Device by a Queue.
+type Job interface {
+	Run(d *Device) error
+	// NeedsSwipe reports whether the job waits for a card to be swiped.
+	NeedsSwipe() bool
+}
+
+// Idempotent is implemented by jobs that are safe to run again
+// after being interrupted, eg. by a ResilientDevice queue.
+type Idempotent interface {
+	Idempotent() bool
+}
+
+// JobFunc adapts a function into a Job that doesn't wait for a swipe.
+type JobFunc func(d *Device) error
+
+func (f JobFunc) Run(d *Device) error { return f(d) }
+
+func (JobFunc) NeedsSwipe() bool { return false }
+
+// ReadJob reads raw data from a card.
+type ReadJob struct {
+	Tracks [3][]byte // set once the job is done
+}
+
+func (j *ReadJob) Run(d *Device) (err error) {
+	j.Tracks, err = d.ReadRawTracks()
+	return
+}
+
+func (*ReadJob) NeedsSwipe() bool { return true }
+
+func (*ReadJob) Idempotent() bool { return true }
+
+// WriteJob writes ISO data, or raw data if Raw is set, to a card.
+// Empty tracks are left untouched.
+type WriteJob struct {
+	Tracks [3][]byte
+	Raw    bool
+}
+
+func (j *WriteJob) Run(d *Device) error {
+	if j.Raw {
+		return d.WriteRawTracks(j.Tracks[0], j.Tracks[1], j.Tracks[2])
+	}
+	return d.WriteISOTracks(j.Tracks[0], j.Tracks[1], j.Tracks[2])
+}
+
+func (*WriteJob) NeedsSwipe() bool { return true }
+
+// EraseJob clears the selected tracks on a card.
+type EraseJob struct {
+	Tracks [3]bool
+}
+
+func (j *EraseJob) Run(d *Device) error {
+	return d.Erase(j.Tracks[0], j.Tracks[1], j.Tracks[2])
+}
+
+func (*EraseJob) NeedsSwipe() bool { return true }
+
+// Handle follows a job submitted to a Queue.
+type Handle struct {
+	Job       Job
+	q         *Queue
+	state     JobState // guarded by q.mu
+	err       error
+	done      chan struct{}
+	events    chan JobState
+	cancel    chan struct{} // closed to cancel the job's swipe wait
+	cancelled bool          // guarded by q.mu
+}
+
+// State returns the job's current state.
+func (h *Handle) State() JobState {
+	h.q.mu.Lock()
+	defer h.q.mu.Unlock()
+	return h.state
+}
+
+// Events returns a channel receiving each state the job enters,
+// closed once the job is done, has failed or was cancelled.
+// It never blocks the queue, so it may be ignored.
+func (h *Handle) Events() <-chan JobState {
+	return h.events
+}
+
+// Done returns a channel closed once the job is finished.
+func (h *Handle) Done() <-chan struct{} {
+	return h.done
+}
+
+// Wait waits for the job to finish and returns its error,
+// or ctx.Err() if ctx is done first.
+func (h *Handle) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-h.done:
+		return h.err
+	}
+}
+
+// Cancel drops the job if it hasn't started yet,
+// or stops it waiting for a swipe if it needs one,
+// and reports whether it did.
+func (h *Handle) Cancel() bool {
+	q := h.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if i := q.index(h); i >= 0 {
+		q.pending = append(q.pending[:i], q.pending[i+1:]...)
+		h.finish(JobCancelled, ErrJobCancelled)
+		return true
+	}
+	return h.cancelSwipe()
+}
+
+// cancelSwipe must be called with q.mu held.
+func (h *Handle) cancelSwipe() bool {
+	switch {
+	case h.cancelled:
+		return true
+	case !h.Job.NeedsSwipe() || h.state != JobRunning && h.state != JobWaitingForSwipe:
+		return false
+	}
+	h.cancelled = true
+	close(h.cancel)
+	return true
+}
+
+// setState must be called with q.mu held.
+func (h *Handle) setState(s JobState) {
+	h.state = s
+	h.events <- s // buffered for every state a job can enter
+}
+
+// finish must be called with q.mu held.
+func (h *Handle) finish(s JobState, err error) {
+	h.err = err
+	h.setState(s)
+	close(h.events)
+	close(h.done)
+}
+
+// Queue runs jobs on a Device one at a time, in order.
+// Jobs can be reordered or cancelled until they start.
+type Queue struct {
+	dev     *Device
+	run     func(Job) error
+	mu      sync.Mutex
+	cond    *sync.Cond
+	pending []*Handle
+	running *Handle
+	closed  bool
+	stopped chan struct{}
+}
+
+func (q *Queue) index(h *Handle) int {
+	for i, p := range q.pending {
+		if p == h {
+			return i
+		}
+	}
+	return -1
+}
+
+// Submit adds j to the end of the queue.
+// Jobs submitted after Close are cancelled immediately.
+func (q *Queue) Submit(j Job) *Handle {
+	h := &Handle{
+		Job:    j,
+		q:      q,
+		done:   make(chan struct{}),
+		events: make(chan JobState, 4),
+		cancel: make(chan struct{}),
+	}
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	h.setState(JobQueued)
+	if q.closed {
+		h.finish(JobCancelled, ErrJobCancelled)
+		return h
+	}
+	q.pending = append(q.pending, h)
+	q.cond.Signal()
+	return h
+}
+
+// Pending returns the jobs that haven't started yet, in order.
+func (q *Queue) Pending() []*Handle {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return append([]*Handle(nil), q.pending...)
+}
+
+// Move moves a job that hasn't started yet to position i of the queue,
+// and reports whether it did.
+func (q *Queue) Move(h *Handle, i int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	from := q.index(h)
+	if from < 0 || i < 0 || i >= len(q.pending) {
+		return false
+	}
+	q.pending = append(q.pending[:from], q.pending[from+1:]...)
+	q.pending = append(q.pending[:i], append([]*Handle{h}, q.pending[i:]...)...)
+	return true
+}
+
+func (q *Queue) next() *Handle {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.pending) == 0 {
+		if q.closed {
+			return nil
+		}
+		q.cond.Wait()
+	}
+	h := q.pending[0]
+	q.pending = q.pending[1:]
+	q.running = h
+	h.setState(JobRunning)
+	return h
+}
+
+// swipeStarted marks h as waiting for a swipe
+// when the device starts waiting for one.
+func (q *Queue) swipeStarted(h *Handle) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if h.state == JobRunning {
+		h.setState(JobWaitingForSwipe)
+	}
+}
+
+func (q *Queue) work() {
+	defer close(q.stopped)
+	for h := q.next(); h != nil; h = q.next() {
+		q.dev.setSwipeWatch(&swipeWatch{
+			started: func() { q.swipeStarted(h) },
+			cancel:  h.cancel,
+		})
+		err := q.run(h.Job)
+		q.dev.setSwipeWatch(nil)
+		q.mu.Lock()
+		switch {
+		case h.cancelled && errors.Is(err, ErrSwipeCancelled):
+			h.finish(JobCancelled, ErrJobCancelled)
+		case err != nil:
+			h.finish(JobFailed, err)
+		default:
+			h.finish(JobDone, nil)
+		}
+		q.running = nil
+		q.mu.Unlock()
+	}
+}
+
+// Close cancels all pending jobs, and the running job if it is
+// waiting for a swipe, and stops the queue once the running job,
+// if any, is finished. It does not close the device.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, h := range q.pending {
+		h.finish(JobCancelled, ErrJobCancelled)
+	}
+	q.pending = nil
+	if q.running != nil {
+		q.running.cancelSwipe()
+	}
+	q.closed = true
+	q.cond.Broadcast()
+}
+
+// Wait waits until the queue is closed and its running job, if any,
+// is finished. Call it before closing the device.
+func (q *Queue) Wait() {
+	<-q.stopped
+}
+
+func newQueue(d *Device, run func(Job) error) *Queue {
+	q := &Queue{dev: d, run: run, stopped: make(chan struct{})}
+	q.cond = sync.NewCond(&q.mu)
+	go q.work()
+	return q
+}
+
+// NewQueue starts a queue running jobs on d.
+// No other goroutine should use d directly while the queue is open.
+func NewQueue(d *Device) *Queue {
+	return newQueue(d, func(j Job) error { return j.Run(d) })
+}
@@ -0,0 +1,153 @@
+package libmsr
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// silentTransport accepts writes and never answers, like a device
+// waiting for a swipe.
+type silentTransport struct {
+	closed chan struct{}
+}
+
+func (t *silentTransport) Read(b []byte) (int, error) {
+	<-t.closed
+	return 0, errors.New("closed")
+}
+
+func (t *silentTransport) Write(b []byte) (int, error) { return len(b), nil }
+
+func (t *silentTransport) Close() error {
+	close(t.closed)
+	return nil
+}
+
+// states returns the states a job entered, once it is finished.
+func states(h *Handle) []JobState {
+	var s []JobState
+	for state := range h.Events() {
+		s = append(s, state)
+	}
+	return s
+}
+
+func checkStates(t *testing.T, h *Handle, want ...JobState) {
+	t.Helper()
+	got := states(h)
+	if len(got) != len(want) {
+		t.Fatalf("job states %v, want %v", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("job states %v, want %v", got, want)
+		}
+	}
+}
+
+func TestQueueOrder(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	q := NewQueue(NewDevice(e))
+	defer q.Close()
+	block := make(chan struct{})
+	first := q.Submit(JobFunc(func(*Device) error { <-block; return nil }))
+	for first.State() != JobRunning {
+		time.Sleep(time.Millisecond)
+	}
+	var order []int
+	var hs []*Handle
+	for i := 0; i < 3; i++ {
+		i := i
+		hs = append(hs, q.Submit(JobFunc(func(*Device) error { order = append(order, i); return nil })))
+	}
+	if !q.Move(hs[2], 0) {
+		t.Fatal("couldn't move a pending job")
+	}
+	if !hs[1].Cancel() {
+		t.Fatal("couldn't cancel a pending job")
+	}
+	if q.Move(first, 0) || first.Cancel() {
+		t.Error("moved or cancelled a running job that doesn't need a swipe")
+	}
+	close(block)
+	for _, h := range hs {
+		h.Wait(context.Background())
+	}
+	if len(order) != 2 || order[0] != 2 || order[1] != 0 {
+		t.Errorf("ran jobs %v, want [2 0]", order)
+	}
+	checkStates(t, first, JobQueued, JobRunning, JobDone)
+	checkStates(t, hs[1], JobQueued, JobCancelled)
+	if err := hs[1].Wait(context.Background()); err != ErrJobCancelled {
+		t.Errorf("cancelled job returned %v", err)
+	}
+}
+
+func TestQueueSwipe(t *testing.T) {
+	e := NewEmulator()
+	defer e.Close()
+	q := NewQueue(NewDevice(e))
+	defer q.Close()
+	j := &ReadJob{}
+	h := q.Submit(j)
+	if err := h.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkStates(t, h, JobQueued, JobRunning, JobWaitingForSwipe, JobDone)
+}
+
+func TestQueueCancelSwipe(t *testing.T) {
+	tr := &silentTransport{closed: make(chan struct{})}
+	defer tr.Close()
+	d := NewDevice(tr)
+	d.SwipeTimeout = time.Minute
+	q := NewQueue(d)
+	defer q.Close()
+	h := q.Submit(&ReadJob{})
+	for deadline := time.Now().Add(time.Second); h.State() != JobWaitingForSwipe; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("job is %s, want waiting for swipe", h.State())
+		}
+	}
+	if !h.Cancel() {
+		t.Fatal("couldn't cancel a job waiting for a swipe")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := h.Wait(ctx); err != ErrJobCancelled {
+		t.Fatalf("cancelled job returned %v", err)
+	}
+	checkStates(t, h, JobQueued, JobRunning, JobWaitingForSwipe, JobCancelled)
+}
+
+func TestQueueClose(t *testing.T) {
+	tr := &silentTransport{closed: make(chan struct{})}
+	defer tr.Close()
+	d := NewDevice(tr)
+	d.SwipeTimeout = time.Minute
+	q := NewQueue(d)
+	running := q.Submit(&EraseJob{Tracks: [3]bool{true, true, true}})
+	pending := q.Submit(&ReadJob{})
+	for running.State() != JobWaitingForSwipe {
+		time.Sleep(time.Millisecond)
+	}
+	q.Close()
+	stopped := make(chan struct{})
+	go func() { q.Wait(); close(stopped) }()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("queue didn't stop with a job waiting for a swipe")
+	}
+	for _, h := range []*Handle{running, pending} {
+		if s := h.State(); s != JobCancelled {
+			t.Errorf("job is %s after closing, want cancelled", s)
+		}
+	}
+	if h := q.Submit(&ReadJob{}); h.State() != JobCancelled {
+		t.Error("job submitted after closing wasn't cancelled")
+	}
+}
@@ -0,0 +1,94 @@
+package libmsr
+
+// RawTrack is raw track data packed as by Device.ReadRawTracks (ReadPacking).
+// Its methods return new tracks, padding the last byte with zeros.
+type RawTrack []byte
+
+// RawTrackFromBits packs one bit per byte into a RawTrack.
+func RawTrackFromBits(bits []byte) RawTrack {
+	return ReadPacking.Pack(bits)
+}
+
+// Bits returns the bits of t, one per byte.
+func (t RawTrack) Bits() []byte {
+	return ReadPacking.Unpack(t)
+}
+
+// Packed returns t packed as p.
+// Use WritePacking for Device.WriteRawTracks.
+func (t RawTrack) Packed(p Packing) []byte {
+	return p.Pack(t.Bits())
+}
+
+// Shift moves the bits of t n bits later, adding zeros at the start,
+// or -n bits earlier if n is negative, dropping bits from the start.
+func (t RawTrack) Shift(n int) RawTrack {
+	bits := t.Bits()
+	if n < 0 {
+		if -n > len(bits) {
+			n = -len(bits)
+		}
+		return RawTrackFromBits(bits[-n:])
+	}
+	return RawTrackFromBits(append(make([]byte, n), bits...))
+}
+
+// Invert flips every bit of t.
+func (t RawTrack) Invert() RawTrack {
+	inv := make(RawTrack, len(t))
+	for i, b := range t {
+		inv[i] = ^b
+	}
+	return inv
+}
+
+// Splice replaces n bits of t at bit offset off
+// with those of src at bit offset srcOff, extending t with zeros if needed.
+// n is cut short at the end of src. Negative arguments are taken as 0.
+func (t RawTrack) Splice(off int, src RawTrack, srcOff, n int) RawTrack {
+	bits, srcBits := t.Bits(), src.Bits()
+	if off < 0 {
+		off = 0
+	}
+	if srcOff < 0 {
+		srcOff = 0
+	}
+	if n < 0 {
+		n = 0
+	}
+	if srcOff > len(srcBits) {
+		srcOff = len(srcBits)
+	}
+	if srcOff+n > len(srcBits) {
+		n = len(srcBits) - srcOff
+	}
+	if off+n > len(bits) {
+		bits = append(bits, make([]byte, off+n-len(bits))...)
+	}
+	copy(bits[off:], srcBits[srcOff:srcOff+n])
+	return RawTrackFromBits(bits)
+}
+
+// LeadingZeros returns the number of zero bits before the first one bit.
+func (t RawTrack) LeadingZeros() int {
+	for i, b := range t.Bits() {
+		if b != 0 {
+			return i
+		}
+	}
+	return len(t) * 8
+}
+
+// StripLeadingZeros removes the zero bits before the first one bit.
+func (t RawTrack) StripLeadingZeros() RawTrack {
+	return t.Shift(-t.LeadingZeros())
+}
+
+// SetLeadingZeros returns t with exactly n zero bits before the first one bit,
+// or none if n is negative.
+func (t RawTrack) SetLeadingZeros(n int) RawTrack {
+	if n < 0 {
+		n = 0
+	}
+	return t.Shift(n - t.LeadingZeros())
+}
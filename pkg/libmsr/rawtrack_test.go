@@ -0,0 +1,85 @@
+package libmsr
+
+import (
+	"bytes"
+	"testing"
+)
+
+const testTrack2 = ";4111111111111111=2705101?"
+
+// testRawTrack returns testTrack2 as read from a card,
+// after lead zeros and followed by trailing zeros.
+func testRawTrack(lead int) RawTrack {
+	f := ISOTrack2
+	bits := make([]byte, lead)
+	var lrc byte
+	for _, c := range []byte(testTrack2) {
+		code, _ := f.code(c)
+		lrc ^= code
+		bits = appendCode(bits, uint16(code), f.BitsPerChar, f.Parity)
+	}
+	bits = appendCode(bits, uint16(lrc), f.BitsPerChar, f.Parity)
+	return RawTrackFromBits(append(bits, make([]byte, 40)...))
+}
+
+// checkDecodes checks that t decodes to want, with a valid LRC if lrcOK,
+// both by DecodeTrack and by DecodeRaw from its first one bit.
+func checkDecodes(t *testing.T, name string, raw RawTrack, want string, lrcOK bool) {
+	t.Helper()
+	chars, _, gotLRCOK := DecodeTrack(raw, ISOTrack2)
+	if string(chars) != want || gotLRCOK != lrcOK {
+		t.Errorf("%s: decoded %q (LRC ok %v), want %q (LRC ok %v)", name, chars, gotLRCOK, want, lrcOK)
+	}
+	chars, parityOK, gotLRCOK := DecodeRaw(raw.StripLeadingZeros(), '0', 5, 8, false)
+	if string(chars) != want || gotLRCOK != lrcOK {
+		t.Errorf("%s: DecodeRaw decoded %q (LRC ok %v), want %q (LRC ok %v)", name, chars, gotLRCOK, want, lrcOK)
+	}
+	for i, ok := range parityOK {
+		if !ok {
+			t.Errorf("%s: DecodeRaw parity error at %d", name, i)
+		}
+	}
+	if r := DecodeTrackResult(raw, ISOTrack2); r.Reversed || r.ParityErrors > 0 {
+		t.Errorf("%s: reversed %v with %d parity errors", name, r.Reversed, r.ParityErrors)
+	}
+}
+
+func TestRawTrackEdits(t *testing.T) {
+	raw := testRawTrack(22)
+	checkDecodes(t, "original", raw, testTrack2, true)
+	checkDecodes(t, "shifted later", raw.Shift(13), testTrack2, true)
+	checkDecodes(t, "shifted earlier", raw.Shift(-20), testTrack2, true)
+	checkDecodes(t, "inverted twice", raw.Invert().Invert(), testTrack2, true)
+	if inv := raw.Invert(); bytes.Equal(inv, raw) || inv.LeadingZeros() != 0 {
+		t.Errorf("inverted %x to %x", raw, inv)
+	}
+
+	for _, n := range []int{0, 7, 61} {
+		got := raw.SetLeadingZeros(n)
+		if got.LeadingZeros() != n {
+			t.Errorf("set %d leading zeros, got %d", n, got.LeadingZeros())
+		}
+		checkDecodes(t, "set leading zeros", got, testTrack2, true)
+	}
+	checkDecodes(t, "stripped leading zeros", raw.StripLeadingZeros(), testTrack2, true)
+
+	// a track moved onto a blank one
+	blank := make(RawTrack, len(raw)+10)
+	checkDecodes(t, "spliced onto blank", blank.Splice(30, raw, 22, len(raw)*8-22), testTrack2, true)
+	// the first PAN digit replaced by a 9, which the LRC catches
+	nine := RawTrackFromBits(appendCode(nil, 9, 5, ParityOdd))
+	checkDecodes(t, "spliced char", raw.Splice(22+5, nine, 0, 5), ";9"+testTrack2[2:], false)
+}
+
+func TestRawTrackSpliceNegative(t *testing.T) {
+	raw := testRawTrack(22)
+	if got := raw.Splice(-8, raw, 0, 16); !bytes.Equal(got, raw) {
+		t.Errorf("splice at -8 gave %x, want %x", got, raw)
+	}
+	if got := raw.Splice(0, raw, -3, 16); !bytes.Equal(got, raw) {
+		t.Errorf("splice from -3 gave %x, want %x", got, raw)
+	}
+	if got := raw.Splice(0, raw.Invert(), 0, -1); !bytes.Equal(got, raw) {
+		t.Errorf("splice of -1 bits gave %x, want %x", got, raw)
+	}
+}
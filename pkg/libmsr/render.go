@@ -0,0 +1,172 @@
+package libmsr
+
+import (
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// Sizes of a rendered track, in pixels.
+const (
+	renderBitWidth = 8
+	renderMargin   = 4
+	renderMarkerH  = 14 // sentinel and LRC markers
+	renderBitsH    = 24
+	renderLabelH   = 16 // character values
+	renderHeight   = 2*renderMargin + renderMarkerH + renderBitsH + renderLabelH
+	renderBitsY    = renderMargin + renderMarkerH
+)
+
+var (
+	renderBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	renderBit        = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	renderBoundary   = color.RGBA{0xb0, 0xb0, 0xb0, 0xff}
+	renderBadParity  = color.RGBA{0xff, 0xc0, 0xc0, 0xff}
+	renderBadText    = color.RGBA{0xd0, 0x00, 0x00, 0xff}
+	renderStart      = color.RGBA{0x20, 0x60, 0xd0, 0xff}
+	renderEnd        = color.RGBA{0x20, 0xa0, 0x40, 0xff}
+	renderLRC        = color.RGBA{0xe0, 0x80, 0x00, 0xff}
+)
+
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// trackView is a raw track laid out for rendering.
+type trackView struct {
+	bits []byte
+	r    *DecodeResult
+}
+
+// newTrackView decodes raw like DecodeTrackResult,
+// laying out the bits in reverse if the card was swiped backwards.
+func newTrackView(raw []byte, f TrackFormat) *trackView {
+	r := decodeResultEitherWay(ReadPacking.Unpack(raw), f)
+	return &trackView{bits: r.bits, r: r}
+}
+
+func (v *trackView) width() int {
+	return 2*renderMargin + len(v.bits)*renderBitWidth
+}
+
+// framed reports whether char i is part of the track's data,
+// so its parity matters.
+func (v *trackView) framed(i int) bool {
+	r := v.r
+	if r.Start >= 0 && i < r.Start {
+		return false
+	}
+	if r.LRCIndex >= 0 {
+		return i <= r.LRCIndex
+	}
+	return i < len(r.Decoded())
+}
+
+// marker returns the label and color marking char i, if any.
+func (v *trackView) marker(i int) (string, color.RGBA, bool) {
+	switch i {
+	case v.r.Start:
+		return "SS", renderStart, true
+	case v.r.End:
+		return "ES", renderEnd, true
+	case v.r.LRCIndex:
+		return "LRC", renderLRC, true
+	}
+	return "", color.RGBA{}, false
+}
+
+// label returns the printable value of c.
+func label(c Char) string {
+	if c.Value < ' ' || c.Value > '~' {
+		return fmt.Sprintf("%02X", c.Value)
+	}
+	return string(rune(c.Value))
+}
+
+// RenderSVG draws raw data from Device.ReadRawTracks, decoded in format f, as SVG:
+// each bit, the boundaries and values of the characters,
+// characters with bad parity in red, and the sentinels and LRC.
+// Cards swiped backwards are drawn in reverse, in reading order.
+func RenderSVG(w io.Writer, raw []byte, f TrackFormat) error {
+	v := newTrackView(raw, f)
+	bpc := f.BitsPerChar * renderBitWidth
+	var b strings.Builder
+	fmt.Fprintf(&b, "<svg xmlns=\"http://www.w3.org/2000/svg\" width=\"%d\" height=\"%d\" font-family=\"monospace\" font-size=\"11\">\n",
+		v.width(), renderHeight)
+	fmt.Fprintf(&b, "<rect width=\"100%%\" height=\"100%%\" fill=\"%s\"/>\n", hexColor(renderBackground))
+	for i, c := range v.r.Chars {
+		x := renderMargin + c.Offset*renderBitWidth
+		textColor := renderBit
+		if !c.ParityOK && v.framed(i) {
+			fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n",
+				x, renderBitsY, bpc, renderBitsH+renderLabelH, hexColor(renderBadParity))
+			textColor = renderBadText
+		}
+		if name, col, ok := v.marker(i); ok {
+			fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n",
+				x, renderMargin, bpc, renderMarkerH-2, hexColor(col))
+			fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" fill=\"%s\" text-anchor=\"middle\">%s</text>\n",
+				x+bpc/2, renderMargin+renderMarkerH-4, hexColor(renderBackground), name)
+		}
+		fmt.Fprintf(&b, "<line x1=\"%d\" y1=\"%d\" x2=\"%d\" y2=\"%d\" stroke=\"%s\"/>\n",
+			x, renderBitsY, x, renderHeight-renderMargin, hexColor(renderBoundary))
+		fmt.Fprintf(&b, "<text x=\"%d\" y=\"%d\" fill=\"%s\" text-anchor=\"middle\">",
+			x+bpc/2, renderHeight-renderMargin-3, hexColor(textColor))
+		xml.EscapeText(&b, []byte(label(c)))
+		b.WriteString("</text>\n")
+	}
+	for i, bit := range v.bits {
+		x := renderMargin + i*renderBitWidth
+		if bit != 0 {
+			fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"%d\" fill=\"%s\"/>\n",
+				x+1, renderBitsY+2, renderBitWidth-2, renderBitsH-4, hexColor(renderBit))
+		} else {
+			fmt.Fprintf(&b, "<rect x=\"%d\" y=\"%d\" width=\"%d\" height=\"2\" fill=\"%s\"/>\n",
+				x+1, renderBitsY+renderBitsH-4, renderBitWidth-2, hexColor(renderBit))
+		}
+	}
+	b.WriteString("</svg>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+// RenderImage draws raw data like RenderSVG, without the text.
+func RenderImage(raw []byte, f TrackFormat) *image.RGBA {
+	v := newTrackView(raw, f)
+	bpc := f.BitsPerChar * renderBitWidth
+	img := image.NewRGBA(image.Rect(0, 0, v.width(), renderHeight))
+	fillRect(img, 0, 0, v.width(), renderHeight, renderBackground)
+	for i, c := range v.r.Chars {
+		x := renderMargin + c.Offset*renderBitWidth
+		if !c.ParityOK && v.framed(i) {
+			fillRect(img, x, renderBitsY, bpc, renderBitsH+renderLabelH, renderBadParity)
+		}
+		if _, col, ok := v.marker(i); ok {
+			fillRect(img, x, renderMargin, bpc, renderMarkerH-2, col)
+		}
+		fillRect(img, x, renderBitsY, 1, renderBitsH+renderLabelH, renderBoundary)
+	}
+	for i, bit := range v.bits {
+		x := renderMargin + i*renderBitWidth
+		if bit != 0 {
+			fillRect(img, x+1, renderBitsY+2, renderBitWidth-2, renderBitsH-4, renderBit)
+		} else {
+			fillRect(img, x+1, renderBitsY+renderBitsH-4, renderBitWidth-2, 2, renderBit)
+		}
+	}
+	return img
+}
+
+// RenderPNG writes the image from RenderImage as PNG.
+func RenderPNG(w io.Writer, raw []byte, f TrackFormat) error {
+	return png.Encode(w, RenderImage(raw, f))
+}
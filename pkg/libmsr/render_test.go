@@ -0,0 +1,69 @@
+package libmsr
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+// renderRaw returns a track 2 swipe packed like Device.ReadRawTracks,
+// forwards and backwards.
+func renderRaw(t *testing.T) (fwd, rev []byte) {
+	bits := swipeBits(t, []byte(";4111111111111111=2705101?"), ISOTrack2, 20)
+	bits = append(bits, make([]byte, 20)...)
+	bits = append(bits, make([]byte, (8-len(bits)%8)%8)...) // whole bytes
+	return ReadPacking.Pack(bits), ReadPacking.Pack(reverseBits(bits))
+}
+
+func TestRenderSVG(t *testing.T) {
+	fwd, rev := renderRaw(t)
+	var b bytes.Buffer
+	if err := RenderSVG(&b, fwd, ISOTrack2); err != nil {
+		t.Fatal(err)
+	}
+	svg := b.String()
+	for _, s := range []string{">SS<", ">ES<", ">LRC<", ">;<", ">?<"} {
+		if !strings.Contains(svg, s) {
+			t.Errorf("no %s in SVG", s)
+		}
+	}
+	if strings.Contains(svg, hexColor(renderBadParity)) {
+		t.Error("bad parity in SVG")
+	}
+	if ss, es := strings.Index(svg, ">SS<"), strings.Index(svg, ">ES<"); ss > es {
+		t.Error("ES drawn before SS")
+	}
+
+	var r bytes.Buffer
+	if err := RenderSVG(&r, rev, ISOTrack2); err != nil {
+		t.Fatal(err)
+	}
+	if r.String() != svg {
+		t.Error("backwards swipe rendered differently")
+	}
+}
+
+func TestRenderPNG(t *testing.T) {
+	fwd, rev := renderRaw(t)
+	var b bytes.Buffer
+	if err := RenderPNG(&b, fwd, ISOTrack2); err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w, h := img.Bounds().Dx(), img.Bounds().Dy(); w != 2*renderMargin+len(fwd)*8*renderBitWidth || h != renderHeight {
+		t.Errorf("rendered %dx%d", w, h)
+	}
+
+	v := newTrackView(fwd, ISOTrack2)
+	x := renderMargin + v.r.Chars[v.r.Start].Offset*renderBitWidth + 1
+	if c := img.At(x, renderMargin); c != renderStart {
+		t.Errorf("start sentinel marked %v", c)
+	}
+	if !bytes.Equal(RenderImage(rev, ISOTrack2).Pix, RenderImage(fwd, ISOTrack2).Pix) {
+		t.Error("backwards swipe rendered differently")
+	}
+}
@@ -0,0 +1,180 @@
+package libmsr
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ConnEvent is a change in a ResilientDevice's connection.
+type ConnEvent int
+
+const (
+	// Disconnected is sent when the transport fails.
+	Disconnected ConnEvent = iota
+	// ReconnectFailed is sent after each failed attempt to reconnect.
+	ReconnectFailed
+	// Reconnected is sent once the device is reopened and its settings restored.
+	Reconnected
+	// GaveUp is sent when no attempts are left.
+	GaveUp
+)
+
+func (e ConnEvent) String() string {
+	switch e {
+	case Disconnected:
+		return "disconnected"
+	case ReconnectFailed:
+		return "reconnect failed"
+	case Reconnected:
+		return "reconnected"
+	case GaveUp:
+		return "gave up reconnecting"
+	}
+	return "unknown"
+}
+
+// ReconnectEvent reports a change in a ResilientDevice's connection.
+type ReconnectEvent struct {
+	Event   ConnEvent
+	Attempt int
+	Err     error
+}
+
+// ErrClosed is returned by a ResilientDevice once it is closed.
+var ErrClosed = errors.New("libmsr: device closed")
+
+// ErrInterrupted is returned by ResilientDevice.DoOnce when the device
+// was disconnected during an operation, which may have taken effect.
+// The device is reconnected, but the operation isn't run again.
+var ErrInterrupted = errors.New("libmsr: operation interrupted by a disconnect")
+
+// ResilientDevice wraps a Device to reopen it when its transport fails,
+// such as when it is unplugged or its hub resets.
+// Its settings (see Device.Config) are restored after reconnecting,
+// and the interrupted operation is run again if it is safe to.
+type ResilientDevice struct {
+	*Device
+	// Reopen finds the device again and opens it, eg. by serial number or path.
+	Reopen func() (Transport, error)
+	// IsDisconnect reports whether err means the transport failed.
+	// It defaults to checking for a *TransportError.
+	IsDisconnect  func(err error) bool
+	RetryInterval time.Duration
+	MaxAttempts   int // per disconnect, 0 for no limit
+	// OnEvent, if set, is called for every change in the connection.
+	// It shouldn't block.
+	OnEvent func(ReconnectEvent)
+	mu      sync.Mutex
+	closed  atomic.Bool
+}
+
+func (r *ResilientDevice) emit(e ReconnectEvent) {
+	if r.OnEvent != nil {
+		r.OnEvent(e)
+	}
+}
+
+func (r *ResilientDevice) isDisconnect(err error) bool {
+	if r.IsDisconnect != nil {
+		return r.IsDisconnect(err)
+	}
+	var te *TransportError
+	return errors.As(err, &te)
+}
+
+// reconnect must be called with r.mu held.
+func (r *ResilientDevice) reconnect(cause error) error {
+	config := r.Device.Config()
+	r.Device.device.Close()
+	r.emit(ReconnectEvent{Event: Disconnected, Err: cause})
+	err := cause
+	for attempt := 1; r.MaxAttempts == 0 || attempt <= r.MaxAttempts; attempt++ {
+		time.Sleep(r.RetryInterval)
+		if r.closed.Load() {
+			return ErrClosed
+		}
+		var t Transport
+		t, err = r.Reopen()
+		if err == nil {
+			r.Device.setTransport(t)
+			if err = r.Device.Reset(); err == nil {
+				err = r.Device.ApplyConfig(config)
+			}
+			if err == nil {
+				r.emit(ReconnectEvent{Event: Reconnected, Attempt: attempt})
+				return nil
+			}
+			t.Close()
+		}
+		r.emit(ReconnectEvent{Event: ReconnectFailed, Attempt: attempt, Err: err})
+	}
+	r.emit(ReconnectEvent{Event: GaveUp, Err: err})
+	return err
+}
+
+// Do runs fn on the device.
+// If fn fails because the device was disconnected,
+// Do reconnects and runs fn again,
+// so fn must be safe to run twice, like reading a card.
+// Calls to Do and DoOnce are serialized.
+func (r *ResilientDevice) Do(fn func(d *Device) error) error {
+	return r.do(fn, true)
+}
+
+// DoOnce is like Do, but returns ErrInterrupted after reconnecting
+// instead of running fn again. Use it for operations like
+// writing a card, which the user has to start over.
+func (r *ResilientDevice) DoOnce(fn func(d *Device) error) error {
+	return r.do(fn, false)
+}
+
+func (r *ResilientDevice) do(fn func(d *Device) error, retry bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed.Load() {
+		return ErrClosed
+	}
+	err := fn(r.Device)
+	if err == nil || !r.isDisconnect(err) {
+		return err
+	}
+	if err = r.reconnect(err); err != nil {
+		return err
+	}
+	if !retry {
+		return ErrInterrupted
+	}
+	return fn(r.Device)
+}
+
+// NewQueue starts a queue running jobs on r.
+// Once the device is reconnected, queued jobs resume
+// and an interrupted job is run again if it is Idempotent.
+func (r *ResilientDevice) NewQueue() *Queue {
+	return newQueue(r.Device, func(j Job) error {
+		if i, ok := j.(Idempotent); ok && i.Idempotent() {
+			return r.Do(j.Run)
+		}
+		return r.DoOnce(j.Run)
+	})
+}
+
+// Close stops reconnecting, then resets and closes the device.
+func (r *ResilientDevice) Close() error {
+	r.closed.Store(true)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.Device.Close()
+}
+
+// NewResilientDevice wraps d, using reopen to reconnect it.
+func NewResilientDevice(d *Device, reopen func() (Transport, error)) *ResilientDevice {
+	return &ResilientDevice{
+		Device:        d,
+		Reopen:        reopen,
+		RetryInterval: time.Second,
+		MaxAttempts:   30,
+	}
+}
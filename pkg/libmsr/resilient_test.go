@@ -0,0 +1,105 @@
+package libmsr
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+)
+
+// flakyTransport passes reports to an emulator,
+// failing once when fail is set, like an unplugged device.
+type flakyTransport struct {
+	e    *Emulator
+	fail *atomic.Bool
+}
+
+var errUnplugged = errors.New("unplugged")
+
+func (t flakyTransport) Read(b []byte) (int, error) { return t.e.Read(b) }
+
+func (t flakyTransport) Write(b []byte) (int, error) {
+	if t.fail.CompareAndSwap(true, false) {
+		return 0, errUnplugged
+	}
+	return t.e.Write(b)
+}
+
+func (flakyTransport) Close() error { return nil } // the emulator outlives reconnects
+
+// newFlakyDevice returns a resilient device on an emulator,
+// and a flag failing its next write.
+func newFlakyDevice(t *testing.T) (*ResilientDevice, *Emulator, *atomic.Bool, *[]ConnEvent) {
+	e := NewEmulator()
+	t.Cleanup(func() { e.Close() })
+	fail := new(atomic.Bool)
+	r := NewResilientDevice(NewDevice(flakyTransport{e, fail}), func() (Transport, error) {
+		return flakyTransport{e, fail}, nil
+	})
+	r.RetryInterval = 0
+	events := new([]ConnEvent)
+	r.OnEvent = func(e ReconnectEvent) { *events = append(*events, e.Event) }
+	return r, e, fail, events
+}
+
+func TestResilientDo(t *testing.T) {
+	r, e, fail, events := newFlakyDevice(t)
+	if err := r.SetLoCo(); err != nil {
+		t.Fatal(err)
+	}
+	e.HiCo = true // lost by the reconnect, to be restored
+	runs := 0
+	fail.Store(true)
+	err := r.Do(func(d *Device) error {
+		runs++
+		return d.TestCommunication()
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if runs != 2 {
+		t.Errorf("ran %d times, want 2", runs)
+	}
+	if e.HiCo {
+		t.Error("lo-co not restored after reconnecting")
+	}
+	if len(*events) != 2 || (*events)[0] != Disconnected || (*events)[1] != Reconnected {
+		t.Errorf("events %v, want [disconnected reconnected]", *events)
+	}
+}
+
+func TestResilientDoOnce(t *testing.T) {
+	r, _, fail, _ := newFlakyDevice(t)
+	runs := 0
+	fail.Store(true)
+	err := r.DoOnce(func(d *Device) error {
+		runs++
+		return d.WriteISOTracks(nil, []byte(";1234?"), nil)
+	})
+	if err != ErrInterrupted {
+		t.Errorf("DoOnce returned %v, want ErrInterrupted", err)
+	}
+	if runs != 1 {
+		t.Errorf("ran %d times, want 1", runs)
+	}
+	if err := r.TestCommunication(); err != nil {
+		t.Errorf("not reconnected: %v", err)
+	}
+}
+
+func TestResilientQueue(t *testing.T) {
+	r, e, fail, _ := newFlakyDevice(t)
+	q := r.NewQueue()
+	defer q.Close()
+	e.ISO[1] = []byte(";1234?")
+	fail.Store(true)
+	read := &ReadJob{}
+	if err := q.Submit(read).Wait(context.Background()); err != nil {
+		t.Errorf("interrupted read not run again: %v", err)
+	}
+	fail.Store(true)
+	write := &WriteJob{Tracks: [3][]byte{nil, []byte(";5678?")}}
+	if err := q.Submit(write).Wait(context.Background()); err != ErrInterrupted {
+		t.Errorf("interrupted write returned %v, want ErrInterrupted", err)
+	}
+}
@@ -0,0 +1,232 @@
+package libmsr
+
+// DecodeResult is a track decoded character by character.
+type DecodeResult struct {
+	Format TrackFormat
+	// Reversed is set if the card was swiped backwards,
+	// so the bits were decoded in reverse and Char offsets count from the end.
+	Reversed bool
+	// Chars are all characters read, including leading nulls,
+	// sentinels and the LRC. If a start sentinel is found,
+	// they are aligned to it.
+	Chars []Char
+	// Start, End and LRCIndex are the indices in Chars
+	// of the start sentinel, end sentinel and LRC, or -1 if not found.
+	// Without sentinels, the last non-null character is taken as the LRC.
+	Start, End, LRCIndex int
+	LRC                  byte // code of the LRC, 0 if not found
+	ExpectedLRC          byte // computed from the characters before the LRC
+	LRCOK                bool // whether LRC and ExpectedLRC match
+	// ParityErrors counts the characters with bad parity
+	// from the start sentinel, if any, up to and including the LRC.
+	ParityErrors int
+	bits         []byte // decoded, reversed if Reversed; nil for streams
+}
+
+// hasSentinels reports whether f has sentinels to look for.
+func (f *TrackFormat) hasSentinels() bool {
+	return f.StartSentinel != 0 || f.EndSentinel != 0
+}
+
+func decodeResult(bits []byte, f TrackFormat) *DecodeResult {
+	r := &DecodeResult{Format: f, bits: bits}
+	if f.BitsPerChar < 1 {
+		r.analyze(-1)
+		return r
+	}
+	start := -1
+	if f.hasSentinels() {
+		start = f.findStart(bits)
+	}
+	pos := 0
+	if start >= 0 {
+		pos = start % f.BitsPerChar
+	}
+	for c, ok := f.readChar(bits, pos); ok; c, ok = f.readChar(bits, pos) {
+		pos += f.BitsPerChar
+		r.Chars = append(r.Chars, c)
+	}
+	r.analyze(start)
+	return r
+}
+
+// junk returns the number of zero bits right before the start sentinel,
+// the number of bits before those, and the number of bits
+// after the LRC (or end sentinel) up to and including the last one bit.
+func (r *DecodeResult) junk() (leadingZeros, leading, trailing int) {
+	if r.Start < 0 {
+		return
+	}
+	start := r.Chars[r.Start].Offset
+	for i := start - 1; i >= 0 && r.bits[i] == 0; i-- {
+		leadingZeros++
+	}
+	leading = start - leadingZeros
+	last := r.LRCIndex
+	if last < 0 {
+		last = r.End
+	}
+	if last < 0 {
+		return
+	}
+	end := r.Chars[last].Offset + r.Format.BitsPerChar
+	for i := len(r.bits) - 1; i >= end; i-- {
+		if r.bits[i] != 0 {
+			return leadingZeros, leading, i + 1 - end
+		}
+	}
+	return
+}
+
+// maxScore is the score of a track that fits its format perfectly.
+const maxScore = 4
+
+// score rates how well r fits its format.
+func (r *DecodeResult) score() int {
+	s := -r.ParityErrors
+	if r.End >= 0 {
+		s += 2
+		if r.LRCIndex >= 0 && r.LRCOK && r.Chars[r.LRCIndex].ParityOK {
+			s += 2
+		}
+	}
+	// Reading a card the wrong way can find a short track by chance,
+	// but rarely with nothing but zeros around it.
+	_, leading, trailing := r.junk()
+	if leading > 0 {
+		s--
+	}
+	if trailing > 0 {
+		s--
+	}
+	return s
+}
+
+// decodeResultEitherWay decodes bits forwards,
+// or backwards if that fits f better.
+func decodeResultEitherWay(bits []byte, f TrackFormat) *DecodeResult {
+	fwd := decodeResult(bits, f)
+	if !f.hasSentinels() || fwd.score() == maxScore {
+		return fwd
+	}
+	rev := decodeResult(reverseBits(bits), f)
+	if rev.Start < 0 {
+		return fwd
+	}
+	rev.Reversed = true
+	if fwd.Start < 0 || rev.score() > fwd.score() {
+		return rev
+	}
+	return fwd
+}
+
+// decodeStream decodes the characters from d, without looking for sentinels.
+func decodeStream(d *Decoder) *DecodeResult {
+	r := &DecodeResult{Format: d.f}
+	for c, err := d.Next(); err == nil; c, err = d.Next() {
+		r.Chars = append(r.Chars, c)
+	}
+	r.analyze(-1)
+	return r
+}
+
+// analyze finds the sentinels and LRC in r.Chars,
+// given the bit offset of the start sentinel, or -1.
+func (r *DecodeResult) analyze(start int) {
+	f := &r.Format
+	r.Start, r.End, r.LRCIndex = -1, -1, -1
+	lastNonNull := -1
+	for i, c := range r.Chars {
+		if c.Offset == start {
+			r.Start = i
+		} else if r.Start >= 0 && r.End < 0 && c.Value == f.EndSentinel {
+			r.End = i
+		}
+		if c.Code != 0x00 {
+			lastNonNull = i
+		}
+	}
+	switch {
+	case r.End >= 0 && r.End+1 < len(r.Chars):
+		r.LRCIndex = r.End + 1
+	case r.Start < 0:
+		r.LRCIndex = lastNonNull
+	}
+	from, to := 0, len(r.Chars)
+	if r.Start >= 0 {
+		from = r.Start
+	}
+	if r.LRCIndex >= 0 {
+		r.LRC = r.Chars[r.LRCIndex].Code
+		to = r.LRCIndex
+	}
+	for _, c := range r.Chars[from:to] {
+		r.ExpectedLRC ^= c.Code
+	}
+	if r.LRCIndex >= 0 {
+		to++
+	}
+	for _, c := range r.Chars[from:to] {
+		if !c.ParityOK {
+			r.ParityErrors++
+		}
+	}
+	r.LRCOK = r.LRC == r.ExpectedLRC
+}
+
+// values returns the values of the decoded characters and their parity
+// from the start sentinel, if any, as returned by DecodeTrack.
+func (r *DecodeResult) values() (chars []byte, parityOK []bool, lrcOK bool) {
+	decoded := r.Decoded()
+	if r.Start >= 0 {
+		decoded = decoded[r.Start:]
+	}
+	chars, parityOK = make([]byte, len(decoded)), make([]bool, len(decoded))
+	for i, c := range decoded {
+		chars[i], parityOK[i] = c.Value, c.ParityOK
+	}
+	return chars, parityOK, r.LRCOK
+}
+
+// DecodeTrackResult decodes raw data from Device.ReadRawTracks in format f,
+// keeping the details of each character.
+// Cards swiped backwards are detected and decoded in reverse.
+func DecodeTrackResult(raw []byte, f TrackFormat) *DecodeResult {
+	return decodeResultEitherWay(ReadPacking.Unpack(raw), f)
+}
+
+// DecodePacked is like DecodeTrackResult, for data packed as p.
+// It decodes the data from EncodePacked with the same arguments.
+func DecodePacked(raw []byte, p Packing, f TrackFormat) *DecodeResult {
+	return decodeResultEitherWay(p.Unpack(raw), f)
+}
+
+// Decoded returns the characters up to the LRC,
+// or up to the last non-null one if there is no LRC.
+func (r *DecodeResult) Decoded() []Char {
+	if r.LRCIndex >= 0 {
+		return r.Chars[:r.LRCIndex]
+	}
+	n := len(r.Chars)
+	for n > 0 && r.Chars[n-1].Code == 0x00 {
+		n--
+	}
+	return r.Chars[:n]
+}
+
+// Data returns the values of the characters between the sentinels,
+// or of all decoded characters if there is no start sentinel.
+func (r *DecodeResult) Data() []byte {
+	chars := r.Decoded()
+	if r.Start >= 0 {
+		chars = chars[r.Start+1:]
+		if r.End >= 0 {
+			chars = chars[:r.End-r.Start-1]
+		}
+	}
+	data := make([]byte, len(chars))
+	for i, c := range chars {
+		data[i] = c.Value
+	}
+	return data
+}
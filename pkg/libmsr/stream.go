@@ -0,0 +1,224 @@
+package libmsr
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Decoder reads characters from a stream of raw track data.
+type Decoder struct {
+	r       io.Reader
+	f       TrackFormat
+	p       Packing
+	raw     [64]byte
+	bits    [64 * 8]byte // bits[head:tail] are yet to be decoded
+	head    int
+	tail    int
+	offset  int // of bits[head] in the stream
+	lrc     byte
+	err     error
+	invalid error        // set if the format or packing is invalid
+	br      bytes.Reader // for ResetBytes
+}
+
+// NewDecoder returns a decoder reading raw data packed as p from r,
+// with characters in format f starting at the first bit.
+func NewDecoder(r io.Reader, f TrackFormat, p Packing) *Decoder {
+	d := &Decoder{r: r, f: f, p: p}
+	if !p.valid() || f.BitsPerChar > 16 || dataBits(f.BitsPerChar, f.Parity) < 1 {
+		d.invalid = errors.New("libmsr.NewDecoder: invalid bits per char or packing")
+	}
+	d.err = d.invalid
+	return d
+}
+
+func (d *Decoder) fill() {
+	d.tail = copy(d.bits[:], d.bits[d.head:d.tail])
+	d.head = 0
+	n := (len(d.bits) - d.tail) / d.p.BitsPerByte
+	if n > len(d.raw) {
+		n = len(d.raw)
+	}
+	// Like bufio, give up on readers that keep returning nothing.
+	read := 0
+	for tries := 0; read == 0 && d.err == nil; tries++ {
+		if tries == 100 {
+			d.err = io.ErrNoProgress
+			break
+		}
+		read, d.err = d.r.Read(d.raw[:n])
+	}
+	d.tail = len(d.p.unpackInto(d.bits[:d.tail], d.raw[:read]))
+}
+
+// Next returns the next character,
+// or io.EOF once there are no whole characters left.
+// Other errors from the reader are returned
+// once the characters read before them are.
+func (d *Decoder) Next() (Char, error) {
+	if d.invalid != nil {
+		return Char{}, d.invalid
+	}
+	bpc := d.f.BitsPerChar
+	for d.tail-d.head < bpc {
+		if d.err != nil {
+			return Char{}, d.err
+		}
+		d.fill()
+	}
+	code, parityOK := readCode(d.bits[:d.tail], d.head, bpc, d.f.Parity)
+	c := Char{Offset: d.offset, Code: byte(code), ParityOK: parityOK}
+	c.Value = d.f.char(c.Code)
+	d.head += bpc
+	d.offset += bpc
+	d.lrc ^= c.Code
+	return c, nil
+}
+
+// Read reads the values of the next characters into b.
+// Use Next to see their parity.
+func (d *Decoder) Read(b []byte) (int, error) {
+	for n := range b {
+		c, err := d.Next()
+		if err != nil {
+			if n > 0 {
+				return n, nil
+			}
+			return 0, err
+		}
+		b[n] = c.Value
+	}
+	return len(b), nil
+}
+
+// Reset makes d read from r from the start,
+// so it can be reused without allocating.
+func (d *Decoder) Reset(r io.Reader) {
+	d.r, d.head, d.tail, d.offset, d.lrc, d.err = r, 0, 0, 0, 0, d.invalid
+}
+
+// ResetBytes makes d read from raw from the start.
+func (d *Decoder) ResetBytes(raw []byte) {
+	d.br.Reset(raw)
+	d.Reset(&d.br)
+}
+
+// DecodeTo reads the rest of the stream like DecodeRaw,
+// into chars and parityOK (which may be nil) rather than new slices,
+// and returns the number of characters decoded,
+// which is more than len(chars) with io.ErrShortBuffer if they don't fit.
+// It doesn't allocate.
+func (d *Decoder) DecodeTo(chars []byte, parityOK []bool) (n int, lrcOK bool, err error) {
+	n = -1 // the last non-null char, taken as the LRC
+	for i := 0; ; i++ {
+		c, err := d.Next()
+		if err != nil {
+			break
+		}
+		if i < len(chars) {
+			chars[i] = c.Value
+		}
+		if i < len(parityOK) {
+			parityOK[i] = c.ParityOK
+		}
+		if c.Code != 0x00 {
+			n = i
+		}
+	}
+	if d.err != io.EOF {
+		return 0, false, d.err
+	}
+	if n < 0 {
+		n = 0
+	}
+	if n > len(chars) {
+		return n, false, io.ErrShortBuffer
+	}
+	return n, d.lrc == 0, nil
+}
+
+// LRC returns the LRC of the characters read so far,
+// which is 0 right after reading a valid LRC.
+func (d *Decoder) LRC() byte {
+	return d.lrc
+}
+
+// Encoder writes characters as a stream of raw track data.
+type Encoder struct {
+	w    io.Writer
+	f    TrackFormat
+	p    Packing
+	bits []byte // fewer than p.BitsPerByte after each write
+	lrc  byte
+	err  error
+}
+
+// NewEncoder returns an encoder writing characters in format f to w,
+// packed as p.
+func NewEncoder(w io.Writer, f TrackFormat, p Packing) *Encoder {
+	e := &Encoder{w: w, f: f, p: p}
+	if !p.valid() || f.BitsPerChar > 16 || dataBits(f.BitsPerChar, f.Parity) < 1 {
+		e.err = errors.New("libmsr.NewEncoder: invalid bits per char or packing")
+	}
+	return e
+}
+
+func (e *Encoder) writeCode(code uint16) {
+	e.bits = appendCode(e.bits, code, e.f.BitsPerChar, e.f.Parity)
+	e.lrc ^= byte(code)
+}
+
+// flush writes the whole bytes, or every bit if all is set.
+func (e *Encoder) flush(all bool) error {
+	n := len(e.bits)
+	if !all {
+		n -= n % e.p.BitsPerByte
+	}
+	if e.err != nil || n == 0 {
+		return e.err
+	}
+	_, e.err = e.w.Write(e.p.Pack(e.bits[:n]))
+	e.bits = append(e.bits[:0], e.bits[n:]...)
+	return e.err
+}
+
+// WriteCode writes a character's code.
+func (e *Encoder) WriteCode(code uint16) error {
+	if e.err != nil {
+		return e.err
+	}
+	e.writeCode(code)
+	return e.flush(false)
+}
+
+// Write writes characters in the encoder's format.
+func (e *Encoder) Write(chars []byte) (int, error) {
+	if e.err != nil {
+		return 0, e.err
+	}
+	for i, c := range chars {
+		code, ok := e.f.code(c)
+		if !ok {
+			e.flush(false)
+			return i, fmt.Errorf("libmsr.Encoder.Write: %q not in %s", c, e.f.Name)
+		}
+		e.writeCode(uint16(code))
+	}
+	return len(chars), e.flush(false)
+}
+
+// Close writes the LRC and pads the last byte with zeros.
+// It doesn't close the underlying writer.
+func (e *Encoder) Close() error {
+	if e.err != nil {
+		return e.err
+	}
+	e.writeCode(uint16(e.lrc))
+	if err := e.flush(true); err != nil {
+		return err
+	}
+	e.err = errors.New("libmsr.Encoder: closed")
+	return nil
+}
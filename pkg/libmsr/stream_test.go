@@ -0,0 +1,182 @@
+package libmsr
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+// testRaw is a full track 2 packed like DecodeRaw expects.
+func testRaw() []byte {
+	chars := []byte(";4111111111111111=27051011234567890123?")
+	return encodeChars(chars, rawFormat('0', 5, false), Packing{BitsPerByte: 8})
+}
+
+func TestDecodeTo(t *testing.T) {
+	raw := testRaw()
+	want, wantParityOK, wantLRCOK := DecodeRaw(raw, '0', 5, 8, false)
+	d := NewDecoder(nil, rawFormat('0', 5, false), Packing{BitsPerByte: 8})
+	chars, parityOK := make([]byte, len(raw)*8/5), make([]bool, len(raw)*8/5)
+	var n int
+	var lrcOK bool
+	var err error
+	allocs := testing.AllocsPerRun(100, func() {
+		d.ResetBytes(raw)
+		n, lrcOK, err = d.DecodeTo(chars, parityOK)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(chars[:n], want) || lrcOK != wantLRCOK {
+		t.Errorf("decoded %q (LRC ok %v), want %q (LRC ok %v)", chars[:n], lrcOK, want, wantLRCOK)
+	}
+	for i, ok := range wantParityOK {
+		if parityOK[i] != ok {
+			t.Errorf("parity of char %d ok is %v, want %v", i, parityOK[i], ok)
+		}
+	}
+	if allocs > 0 {
+		t.Errorf("%v allocs per decode, want 0", allocs)
+	}
+}
+
+func TestDecoderInvalid(t *testing.T) {
+	for _, f := range []TrackFormat{
+		{BitsPerChar: 0},
+		{BitsPerChar: -1},
+		{BitsPerChar: 17},
+		{BitsPerChar: 1, Parity: ParityOdd}, // parity but no data
+	} {
+		d := NewDecoder(bytes.NewReader(testRaw()), f, ReadPacking)
+		if _, err := d.Next(); err == nil || err == io.EOF {
+			t.Errorf("%d bpc: Next returned %v", f.BitsPerChar, err)
+		}
+		d.ResetBytes(testRaw())
+		if _, _, err := d.DecodeTo(make([]byte, 100), nil); err == nil {
+			t.Errorf("%d bpc: no error from DecodeTo", f.BitsPerChar)
+		}
+	}
+}
+
+// stallReader returns its data, then nothing without an error.
+type stallReader struct {
+	data []byte
+}
+
+func (r *stallReader) Read(b []byte) (int, error) {
+	n := copy(b, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+func TestDecoderNoProgress(t *testing.T) {
+	d := NewDecoder(&stallReader{testRaw()}, rawFormat('0', 5, false), ReadPacking)
+	n := 0
+	var err error
+	for ; err == nil; n++ {
+		_, err = d.Next()
+	}
+	if err != io.ErrNoProgress || n-1 != len(testRaw())*8/5 {
+		t.Errorf("decoded %d chars, then %v", n-1, err)
+	}
+}
+
+var errBroken = errors.New("broken")
+
+// TestDecoderError checks that characters read along with an error
+// are returned before it, and the error after them.
+func TestDecoderError(t *testing.T) {
+	raw := testRaw()
+	r := io.MultiReader(bytes.NewReader(raw), &errReader{errBroken})
+	d := NewDecoder(r, rawFormat('0', 5, false), ReadPacking)
+	n := 0
+	var err error
+	for ; err == nil; n++ {
+		_, err = d.Next()
+	}
+	if err != errBroken || n-1 != len(raw)*8/5 {
+		t.Errorf("decoded %d chars, then %v", n-1, err)
+	}
+	if _, err := d.Next(); err != errBroken {
+		t.Errorf("then %v", err)
+	}
+}
+
+type errReader struct{ err error }
+
+func (r *errReader) Read([]byte) (int, error) { return 0, r.err }
+
+func BenchmarkDecodeRaw(b *testing.B) {
+	raw := testRaw()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		DecodeRaw(raw, '0', 5, 8, false)
+	}
+}
+
+// decodeRawBaseline is DecodeRaw as it was before the Decoder, kept
+// as the reference for BenchmarkDecodeRawBaseline.
+func decodeRawBaseline(raw []byte, offset byte, bpcRaw, bpcChars int, parityEven bool) (chars []byte, parityOK []bool, lrcOK bool) {
+	chars, parityOK = make([]byte, 0), make([]bool, 0)
+	if len(raw) < 1 {
+		lrcOK = true
+		return
+	}
+	remCount := 0
+	var remBits uint16
+	var lrc byte
+	lastNonNull := -1
+	for _, b := range raw {
+		remCount += bpcChars
+		remBits <<= bpcChars
+		remBits |= uint16(b) & ((0x01 << bpcChars) - 1)
+		for remCount >= bpcRaw {
+			remCount -= bpcRaw
+			i := byte(remBits >> remCount)
+			remBits &= (0x01 << remCount) - 1
+
+			p := i & 0x01
+			var c byte
+			for j := bpcRaw - 1; j > 0; j-- {
+				i >>= 1
+				p ^= i & 0x01
+				c |= (i & 0x01) << (j - 1)
+			}
+			if c != 0x00 {
+				lastNonNull = len(chars)
+			}
+			lrc ^= c
+			c += offset
+			chars = append(chars, c)
+			parityOK = append(parityOK, parityEven != (p&0x01 == 0x01))
+		}
+	}
+	chars, parityOK = chars[:lastNonNull], parityOK[:lastNonNull]
+	lrcOK = lrc == 0
+	return
+}
+
+func BenchmarkDecodeRawBaseline(b *testing.B) {
+	raw := testRaw()
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		decodeRawBaseline(raw, '0', 5, 8, false)
+	}
+}
+
+func BenchmarkDecoderDecodeTo(b *testing.B) {
+	raw := testRaw()
+	d := NewDecoder(nil, rawFormat('0', 5, false), Packing{BitsPerByte: 8})
+	chars, parityOK := make([]byte, len(raw)*8/5), make([]bool, len(raw)*8/5)
+	b.ReportAllocs()
+	b.SetBytes(int64(len(raw)))
+	for i := 0; i < b.N; i++ {
+		d.ResetBytes(raw)
+		if _, _, err := d.DecodeTo(chars, parityOK); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
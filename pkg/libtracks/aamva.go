@@ -57,7 +57,7 @@ const (
 
 var aamvaTrack1Re = regexp.MustCompile(`^%([A-Z]{2})([^\^]{2,12}\^|[^\^]{13})([^\^]{2,34}\^|[^\^]{35})([^\^]{2,28}\^|[^\^]{29,})\?$`)
 var aamvaTrack2Re = regexp.MustCompile(`^;([0-9])([0-9]{1,13})=([0-9]{4})([0-9]{8})([0-9]{1,5}|=)\?$`)
-var aamvaTrack3Re = regexp.MustCompile(`^%([0-9])(.)([A-Z0-9 ]{11})([A-Z0-9 ]{2})([A-Z0-9 ]{10})([A-Z0-9 ]{4})([A-Z0-9])([0-9]{3}|   )([0-9 ]{3}|   )([A-Z]{3}|   )([A-Z]{3}|   )([^\?]+)\?$`)
+var aamvaTrack3Re = regexp.MustCompile(`^%([0-9])(.)([A-Z0-9 ]{11})([A-Z0-9 ]{2})([A-Z0-9 ]{10})([A-Z0-9 ]{4})([A-Z0-9])([0-9]{3}|   )([0-9 ]{3}|   )([A-Z]{3}|   )([A-Z]{3}|   )([^\?]*)\?$`)
 
 func (t *AAMVATrack1) String() string {
 	var b strings.Builder
@@ -156,7 +156,7 @@ func (t *AAMVATrack3) String() string {
 		b.WriteString("   ")
 	}
 	if t.Weight != 0 {
-		fmt.Fprintf(&b, "% 3d", t.Weight)
+		fmt.Fprintf(&b, "%3d", t.Weight)
 	} else {
 		b.WriteString("   ")
 	}
@@ -216,12 +216,12 @@ func NewAAMVATrack2(s string) (*AAMVATrack2, error) {
 	var t AAMVATrack2
 	t.IIN = groups[1][0]
 	t.ID = groups[2]
-	if groups[5] != "=" {
-		t.ID += groups[4]
+	if groups[5] != "=" { // overflow
+		t.ID += groups[5]
 	}
 	switch groups[3][2:] {
 	case "77", "88", "99":
-		t.ExpDate, err = time.Parse("06", groups[2][:2])
+		t.ExpDate, err = time.Parse("06", groups[3][:2])
 		if err != nil {
 			return nil, err
 		}
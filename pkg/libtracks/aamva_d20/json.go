@@ -0,0 +1,75 @@
+package aamvad20
+
+import (
+	"encoding/json"
+	"errors"
+)
+
+// code is the JSON form of an enum: its code on the card and what it means.
+type code struct {
+	Code        string `json:"code"`
+	Description string `json:"description"`
+}
+
+// unmarshalCode accepts either a code object or just the code as a string.
+func unmarshalCode(data []byte) (string, error) {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		return s, nil
+	}
+	var c code
+	err := json.Unmarshal(data, &c)
+	return c.Code, err
+}
+
+type heightJSON struct {
+	Feet   int `json:"feet"`
+	Inches int `json:"inches"`
+}
+
+func (h *Height) MarshalJSON() ([]byte, error) {
+	return json.Marshal(heightJSON(*h))
+}
+
+func (h *Height) UnmarshalJSON(data []byte) error {
+	var j heightJSON
+	err := json.Unmarshal(data, &j)
+	*h = Height(j)
+	return err
+}
+
+func (s Sex) MarshalJSON() ([]byte, error) {
+	return json.Marshal(code{string(s), s.String()})
+}
+
+func (s *Sex) UnmarshalJSON(data []byte) error {
+	c, err := unmarshalCode(data)
+	if err != nil {
+		return err
+	}
+	if len(c) != 1 {
+		return errors.New("aamvad20.Sex.UnmarshalJSON: code must be 1 character")
+	}
+	*s = Sex(c[0])
+	return nil
+}
+
+func (hc HairColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(code{string(hc), hc.String()})
+}
+
+func (hc *HairColor) UnmarshalJSON(data []byte) error {
+	c, err := unmarshalCode(data)
+	*hc = HairColor(c)
+	return err
+}
+
+func (ec EyeColor) MarshalJSON() ([]byte, error) {
+	return json.Marshal(code{string(ec), ec.String()})
+}
+
+func (ec *EyeColor) UnmarshalJSON(data []byte) error {
+	c, err := unmarshalCode(data)
+	*ec = EyeColor(c)
+	return err
+}
@@ -0,0 +1,24 @@
+package libtracks
+
+import (
+	"math/rand"
+	"testing"
+)
+
+func FuzzParse(f *testing.F) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 5; i++ {
+		t1, _ := randIEC7813Track1(r).MarshalText()
+		t2, _ := randIEC7813Track2(r).MarshalText()
+		f.Add(string(t1), string(t2), "")
+		t1, _ = randAAMVATrack1(r, 2+r.Intn(30)).MarshalText()
+		t2, _ = randAAMVATrack2(r, 1+r.Intn(17), "").MarshalText()
+		t3, _ := randAAMVATrack3(r).MarshalText()
+		f.Add(string(t1), string(t2), string(t3))
+	}
+	f.Fuzz(func(t *testing.T, t1, t2, t3 string) {
+		if m, _, err := Parse(t1, t2, t3); err == nil {
+			_ = m.Informer.Info().String()
+		}
+	})
+}
@@ -29,8 +29,8 @@ type (
 	}
 )
 
-var iec7813Track1Re = regexp.MustCompile(`^%B([0-9]{1,19})\^([^\^]{2,26})\^([0-9]{4}|\^)([0-9]{3}|\^)([^\?]+)\?$`)
-var iec7813Track2Re = regexp.MustCompile(`^;([0-9]{1,19})\=([0-9]{4}|\=)([0-9]{3}|\=)([^\?]+)\?$`)
+var iec7813Track1Re = regexp.MustCompile(`^%B([0-9]{1,19})\^([^\^]{2,26})\^([0-9]{4}|\^)([0-9]{3}|\^)([^\?]*)\?$`)
+var iec7813Track2Re = regexp.MustCompile(`^;([0-9]{1,19})\=([0-9]{4}|\=)([0-9]{3}|\=)([^\?]*)\?$`)
 
 func (t *IEC7813Track1) String() string {
 	var b strings.Builder
@@ -54,6 +54,14 @@ func (t *IEC7813Track1) String() string {
 	return b.String()
 }
 
+// expDateInfo describes an expiration date, which cards may leave out.
+func expDateInfo(d *time.Time) *Info {
+	if d == nil {
+		return NewInfo("Expiration date", "none")
+	}
+	return NewInfo("Expiration date", d.Format("2006-01"))
+}
+
 func (t *IEC7813Track1) Info() *Info {
 	if t == nil {
 		return NewInfo("Track 1", "nil")
@@ -61,7 +69,7 @@ func (t *IEC7813Track1) Info() *Info {
 	return NewInfo("Track 1", t.String(),
 		&t.PAN,
 		NewInfo("Name", t.Name),
-		NewInfo("Expiration date", t.ExpDate.Format("2006-01")),
+		expDateInfo(t.ExpDate),
 		NewInfo("Service code", t.ServiceCode),
 		NewInfo("Discretionary data", t.Discretionary),
 	)
@@ -93,7 +101,7 @@ func (t *IEC7813Track2) Info() *Info {
 	}
 	return NewInfo("Track 2", t.String(),
 		&t.PAN,
-		NewInfo("Expiration date", t.ExpDate.Format("2006-01")),
+		expDateInfo(t.ExpDate),
 		NewInfo("Service code", t.ServiceCode),
 		NewInfo("Discretionary data", t.Discretionary),
 	)
@@ -136,7 +144,7 @@ func NewIEC7813Track2(s string) (*IEC7813Track2, error) {
 	if err != nil {
 		return nil, err
 	}
-	if groups[1] != "=" {
+	if groups[2] != "=" {
 		time, err := time.Parse(expDateLayout, groups[2])
 		if err != nil {
 			return nil, err
@@ -0,0 +1,259 @@
+package libtracks
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	aamvad20 "github.com/egginabucket/openmsr/pkg/libtracks/aamva_d20"
+)
+
+// Schema is the JSON Schema of IEC7813Tracks and AAMVATracks as JSON.
+//
+//go:embed schema.json
+var Schema []byte
+
+// Dates are encoded as ISO 8601 calendar dates,
+// or just the year and month for expiration dates.
+const (
+	jsonMonthLayout = "2006-01"
+	jsonDateLayout  = "2006-01-02"
+)
+
+// jsonTime is a time encoded with layout.
+type jsonTime struct {
+	t      *time.Time
+	layout string
+}
+
+func (j jsonTime) MarshalJSON() ([]byte, error) {
+	return json.Marshal(j.t.Format(j.layout))
+}
+
+func (j jsonTime) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	t, err := time.Parse(j.layout, s)
+	if err != nil {
+		return err
+	}
+	*j.t = t
+	return nil
+}
+
+// month returns a JSON expiration date for *t, or nil if t is nil.
+func month(t *time.Time) *jsonTime {
+	if t == nil {
+		return nil
+	}
+	return &jsonTime{t, jsonMonthLayout}
+}
+
+// char is a single character encoded as a string.
+type char byte
+
+func (c char) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(rune(c)))
+}
+
+func (c *char) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	if len(s) != 1 {
+		return fmt.Errorf("libtracks: %q is not a single character", s)
+	}
+	*c = char(s[0])
+	return nil
+}
+
+func (n PAN) MarshalJSON() ([]byte, error) {
+	return json.Marshal(n.String())
+}
+
+func (n *PAN) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	p, err := NewPAN(s)
+	if err == nil {
+		*n = p
+	}
+	return err
+}
+
+type iec7813TrackJSON struct {
+	PAN           PAN       `json:"pan"`
+	Name          *string   `json:"name,omitempty"` // track 1 only
+	ExpDate       *jsonTime `json:"exp_date,omitempty"`
+	ServiceCode   string    `json:"service_code,omitempty"`
+	Discretionary string    `json:"discretionary"`
+}
+
+type iec7813TracksJSON struct {
+	Track1 *IEC7813Track1 `json:"track1"`
+	Track2 *IEC7813Track2 `json:"track2"`
+}
+
+func (t *IEC7813Tracks) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iec7813TracksJSON(*t))
+}
+
+func (t *IEC7813Tracks) UnmarshalJSON(data []byte) error {
+	var j iec7813TracksJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*t = IEC7813Tracks(j)
+	return nil
+}
+
+func (t *IEC7813Track1) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iec7813TrackJSON{t.PAN, &t.Name, month(t.ExpDate), t.ServiceCode, t.Discretionary})
+}
+
+func (t *IEC7813Track1) UnmarshalJSON(data []byte) error {
+	var exp time.Time
+	j := iec7813TrackJSON{Name: &t.Name, ExpDate: &jsonTime{&exp, jsonMonthLayout}}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	t.PAN, t.ServiceCode, t.Discretionary = j.PAN, j.ServiceCode, j.Discretionary
+	t.ExpDate = nil
+	if !exp.IsZero() {
+		t.ExpDate = &exp
+	}
+	return nil
+}
+
+func (t *IEC7813Track2) MarshalJSON() ([]byte, error) {
+	return json.Marshal(iec7813TrackJSON{t.PAN, nil, month(t.ExpDate), t.ServiceCode, t.Discretionary})
+}
+
+func (t *IEC7813Track2) UnmarshalJSON(data []byte) error {
+	var exp time.Time
+	j := iec7813TrackJSON{ExpDate: &jsonTime{&exp, jsonMonthLayout}}
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	t.PAN, t.ServiceCode, t.Discretionary = j.PAN, j.ServiceCode, j.Discretionary
+	t.ExpDate = nil
+	if !exp.IsZero() {
+		t.ExpDate = &exp
+	}
+	return nil
+}
+
+type aamvaTracksJSON struct {
+	Track1 *AAMVATrack1 `json:"track1"`
+	Track2 *AAMVATrack2 `json:"track2"`
+	Track3 *AAMVATrack3 `json:"track3"`
+}
+
+func (t *AAMVATracks) MarshalJSON() ([]byte, error) {
+	return json.Marshal(aamvaTracksJSON(*t))
+}
+
+func (t *AAMVATracks) UnmarshalJSON(data []byte) error {
+	var j aamvaTracksJSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*t = AAMVATracks(j)
+	return nil
+}
+
+type aamvaTrack1JSON struct {
+	StateOrProv string   `json:"state_or_province"`
+	City        string   `json:"city"`
+	Name        []string `json:"name"`
+	Address     []string `json:"address"`
+}
+
+func (t *AAMVATrack1) MarshalJSON() ([]byte, error) {
+	return json.Marshal(aamvaTrack1JSON(*t))
+}
+
+func (t *AAMVATrack1) UnmarshalJSON(data []byte) error {
+	var j aamvaTrack1JSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*t = AAMVATrack1(j)
+	return nil
+}
+
+type aamvaTrack2JSON struct {
+	IIN           char     `json:"iin"`
+	ID            string   `json:"id"`
+	ExpDate       jsonTime `json:"exp_date"`
+	NonExp        bool     `json:"non_expiring"`
+	ExpBirthMonth bool     `json:"expires_on_birth_month"`
+	ExpBirthDay   bool     `json:"expires_after_birth_month"`
+	BirthDate     jsonTime `json:"birth_date"`
+}
+
+func (t *AAMVATrack2) json() *aamvaTrack2JSON {
+	return &aamvaTrack2JSON{
+		IIN:           char(t.IIN),
+		ID:            t.ID,
+		ExpDate:       jsonTime{&t.ExpDate, jsonMonthLayout},
+		NonExp:        t.NonExp,
+		ExpBirthMonth: t.ExpBirthMonth,
+		ExpBirthDay:   t.ExpBirthDay,
+		BirthDate:     jsonTime{&t.BirthDate, jsonDateLayout},
+	}
+}
+
+func (t *AAMVATrack2) MarshalJSON() ([]byte, error) {
+	return json.Marshal(t.json())
+}
+
+func (t *AAMVATrack2) UnmarshalJSON(data []byte) error {
+	j := t.json()
+	if err := json.Unmarshal(data, j); err != nil {
+		return err
+	}
+	t.IIN, t.ID = byte(j.IIN), j.ID
+	t.NonExp, t.ExpBirthMonth, t.ExpBirthDay = j.NonExp, j.ExpBirthMonth, j.ExpBirthDay
+	return nil
+}
+
+type aamvaTrack3JSON struct {
+	CDSVersion    int                `json:"cds_version"`
+	JdxVersion    char               `json:"jurisdiction_version"`
+	PostalCode    string             `json:"postal_code"`
+	Class         string             `json:"class"`
+	Restrictions  string             `json:"restrictions"`
+	Endorsements  string             `json:"endorsements"`
+	Sex           aamvad20.Sex       `json:"sex"`
+	Height        *aamvad20.Height   `json:"height,omitempty"`
+	Weight        int                `json:"weight,omitempty"`
+	HairColor     aamvad20.HairColor `json:"hair_color,omitempty"`
+	EyeColor      aamvad20.EyeColor  `json:"eye_color,omitempty"`
+	Discretionary string             `json:"discretionary"`
+}
+
+func (t *AAMVATrack3) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&aamvaTrack3JSON{
+		t.CDSVersion, char(t.JdxVersion), t.PostalCode, t.Class, t.Restrictions, t.Endorsements,
+		t.Sex, t.Height, t.Weight, t.HairColor, t.EyeColor, t.Discretionary,
+	})
+}
+
+func (t *AAMVATrack3) UnmarshalJSON(data []byte) error {
+	var j aamvaTrack3JSON
+	if err := json.Unmarshal(data, &j); err != nil {
+		return err
+	}
+	*t = AAMVATrack3{
+		j.CDSVersion, byte(j.JdxVersion), j.PostalCode, j.Class, j.Restrictions, j.Endorsements,
+		j.Sex, j.Height, j.Weight, j.HairColor, j.EyeColor, j.Discretionary,
+	}
+	return nil
+}
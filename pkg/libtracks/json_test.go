@@ -0,0 +1,199 @@
+package libtracks
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	aamvad20 "github.com/egginabucket/openmsr/pkg/libtracks/aamva_d20"
+)
+
+// validate checks v against the parts of JSON Schema used by Schema.
+func validate(schema, defs map[string]any, v any) error {
+	if ref, ok := schema["$ref"].(string); ok {
+		def, ok := defs[strings.TrimPrefix(ref, "#/$defs/")].(map[string]any)
+		if !ok {
+			return fmt.Errorf("no definition for %s", ref)
+		}
+		if err := validate(def, defs, v); err != nil {
+			return fmt.Errorf("%s: %w", ref, err)
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		n := 0
+		var errs []string
+		for _, s := range oneOf {
+			if err := validate(s.(map[string]any), defs, v); err != nil {
+				errs = append(errs, err.Error())
+			} else {
+				n++
+			}
+		}
+		if n != 1 {
+			return fmt.Errorf("%d of oneOf match: %s", n, strings.Join(errs, "; "))
+		}
+	}
+	if typ, ok := schema["type"].(string); ok {
+		if err := checkType(typ, v); err != nil {
+			return err
+		}
+	}
+	switch v := v.(type) {
+	case map[string]any:
+		props, _ := schema["properties"].(map[string]any)
+		required, _ := schema["required"].([]any)
+		for _, k := range required {
+			if _, ok := v[k.(string)]; !ok {
+				return fmt.Errorf("missing %s", k)
+			}
+		}
+		for k, x := range v {
+			s, ok := props[k].(map[string]any)
+			if !ok {
+				if schema["additionalProperties"] == false {
+					return fmt.Errorf("unexpected %s", k)
+				}
+				continue
+			}
+			if err := validate(s, defs, x); err != nil {
+				return fmt.Errorf("%s: %w", k, err)
+			}
+		}
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, x := range v {
+				if err := validate(items, defs, x); err != nil {
+					return fmt.Errorf("%d: %w", i, err)
+				}
+			}
+		}
+	case string:
+		if p, ok := schema["pattern"].(string); ok && !regexp.MustCompile(p).MatchString(v) {
+			return fmt.Errorf("%q doesn't match %s", v, p)
+		}
+		n := float64(utf8.RuneCountInString(v))
+		if min, ok := schema["minLength"].(float64); ok && n < min {
+			return fmt.Errorf("%q is too short", v)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && n > max {
+			return fmt.Errorf("%q is too long", v)
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			return fmt.Errorf("%v is below %v", v, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			return fmt.Errorf("%v is above %v", v, max)
+		}
+	}
+	return nil
+}
+
+func checkType(typ string, v any) error {
+	var ok bool
+	switch typ {
+	case "object":
+		_, ok = v.(map[string]any)
+	case "array":
+		_, ok = v.([]any)
+	case "string":
+		_, ok = v.(string)
+	case "boolean":
+		_, ok = v.(bool)
+	case "integer":
+		f, isNum := v.(float64)
+		ok = isNum && f == math.Trunc(f)
+	case "null":
+		ok = v == nil
+	}
+	if !ok {
+		return fmt.Errorf("%v is not of type %s", v, typ)
+	}
+	return nil
+}
+
+// checkJSON checks that tracks encode as described by Schema
+// and decode back into a new value of their type.
+func checkJSON(tb testing.TB, tracks any) {
+	tb.Helper()
+	data, err := json.Marshal(tracks)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(Schema, &schema); err != nil {
+		tb.Fatal(err)
+	}
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		tb.Fatal(err)
+	}
+	if err := validate(schema, schema["$defs"].(map[string]any), v); err != nil {
+		tb.Fatalf("%s: %v", data, err)
+	}
+	got := reflect.New(reflect.TypeOf(tracks).Elem()).Interface()
+	if err := json.Unmarshal(data, got); err != nil {
+		tb.Fatalf("decoding %s: %v", data, err)
+	}
+	if !reflect.DeepEqual(got, tracks) {
+		tb.Fatalf("decoded %s to %+v, want %+v", data, got, tracks)
+	}
+}
+
+func TestIEC7813JSON(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		checkJSON(t, &IEC7813Tracks{randIEC7813Track1(r), randIEC7813Track2(r)})
+	}
+	checkJSON(t, &IEC7813Tracks{Track2: randIEC7813Track2(r)})
+}
+
+func TestAAMVAJSON(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		exp := []string{"", expMonthNonExp, expMonthBirth, expMonthBirthDay}[r.Intn(4)]
+		checkJSON(t, &AAMVATracks{
+			randAAMVATrack1(r, 2+r.Intn(39)),
+			randAAMVATrack2(r, 1+r.Intn(18), exp),
+			randAAMVATrack3(r),
+		})
+	}
+	checkJSON(t, &AAMVATracks{Track3: randAAMVATrack3(r)})
+}
+
+func TestJSONFields(t *testing.T) {
+	exp := randDate(rand.New(rand.NewSource(1)))
+	pan, _ := NewPAN("4111111111111111")
+	data, err := json.Marshal(&IEC7813Tracks{Track2: &IEC7813Track2{PAN: pan, ExpDate: &exp}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := fmt.Sprintf(`{"track1":null,"track2":{"pan":"4111111111111111","exp_date":%q,"discretionary":""}}`,
+		exp.Format("2006-01"))
+	if string(data) != want {
+		t.Errorf("encoded %s, want %s", data, want)
+	}
+
+	data, err = json.Marshal(&AAMVATrack3{Sex: aamvad20.Sex('2'), Height: &aamvad20.Height{Feet: 5, Inches: 11}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sex := fmt.Sprintf(`"sex":{"code":"2","description":%q}`, aamvad20.Sex('2').String())
+	if !strings.Contains(string(data), sex) || !strings.Contains(string(data), `"height":{"feet":5,"inches":11}`) {
+		t.Errorf("encoded %s", data)
+	}
+
+	var t3 AAMVATrack3
+	if err := json.Unmarshal([]byte(`{"sex":"1","hair_color":"BRO"}`), &t3); err != nil {
+		t.Fatal(err)
+	}
+	if t3.Sex != '1' || t3.HairColor != aamvad20.HairBrown {
+		t.Errorf("decoded bare codes to %+v", t3)
+	}
+}
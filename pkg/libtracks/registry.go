@@ -0,0 +1,108 @@
+package libtracks
+
+import (
+	"errors"
+	"sort"
+	"sync"
+)
+
+// Format is a card format that can be parsed from track data.
+type Format struct {
+	Name string
+	// Parse parses the data of tracks 1 to 3,
+	// with how sure it is the card is in this format, from 0 to 1.
+	Parse func(t1, t2, t3 string) (in Informer, confidence float64, err error)
+}
+
+// Match is a format that parsed some track data.
+type Match struct {
+	Format     string
+	Informer   Informer
+	Confidence float64
+}
+
+// ErrNoFormat is returned by Parse when no format matches.
+var ErrNoFormat = errors.New("libtracks: no format matches")
+
+var (
+	formatsMu sync.RWMutex
+	formats   []Format
+)
+
+// Register adds a format for Parse to try.
+// It panics if a format with the same name is already registered.
+func Register(f Format) {
+	formatsMu.Lock()
+	defer formatsMu.Unlock()
+	if f.Parse == nil {
+		panic("libtracks.Register: Parse is nil")
+	}
+	for _, g := range formats {
+		if g.Name == f.Name {
+			panic("libtracks.Register: " + f.Name + " registered twice")
+		}
+	}
+	formats = append(formats, f)
+}
+
+// Formats returns the names of the registered formats.
+func Formats() []string {
+	formatsMu.RLock()
+	defer formatsMu.RUnlock()
+	names := make([]string, len(formats))
+	for i, f := range formats {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// Parse tries each registered format on the data of tracks 1 to 3,
+// and returns the best match, and every match, best first.
+func Parse(t1, t2, t3 string) (best *Match, matches []Match, err error) {
+	formatsMu.RLock()
+	fs := append([]Format(nil), formats...)
+	formatsMu.RUnlock()
+	for _, f := range fs {
+		in, confidence, err := f.Parse(t1, t2, t3)
+		if err == nil {
+			matches = append(matches, Match{f.Name, in, confidence})
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil, ErrNoFormat
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		return matches[i].Confidence > matches[j].Confidence
+	})
+	return &matches[0], matches, nil
+}
+
+func init() {
+	Register(Format{
+		Name: "ISO/IEC 7813",
+		Parse: func(t1, t2, t3 string) (Informer, float64, error) {
+			t, err := NewIEC7813Tracks(t1, t2)
+			if err != nil {
+				return nil, 0, err
+			}
+			score := 6 // out of 10
+			if t.Track1.PAN.IsLuhnValid() && t.Track2.PAN.IsLuhnValid() {
+				score += 3
+			}
+			if t.Track1.PAN.String() == t.Track2.PAN.String() {
+				score += 1
+			}
+			return t, float64(score) / 10, nil
+		},
+	})
+	Register(Format{
+		Name: "AAMVA DL",
+		Parse: func(t1, t2, t3 string) (Informer, float64, error) {
+			t, err := NewAAMVATracks(t1, t2, t3)
+			if err != nil {
+				return nil, 0, err
+			}
+			return t, 0.9, nil // all three tracks matched
+		},
+	})
+}
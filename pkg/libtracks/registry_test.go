@@ -0,0 +1,90 @@
+package libtracks
+
+import (
+	"errors"
+	"math/rand"
+	"testing"
+)
+
+func TestParseDetects(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 100; i++ {
+		pan, _ := NewPAN("4111111111111111")
+		t1, t2 := randIEC7813Track1(r), randIEC7813Track2(r)
+		t1.PAN, t2.PAN = pan, pan
+		text1, _ := t1.MarshalText()
+		text2, _ := t2.MarshalText()
+		best, matches, err := Parse(string(text1), string(text2), "")
+		if err != nil {
+			t.Fatalf("parsing %q, %q: %v", text1, text2, err)
+		}
+		if best.Format != "ISO/IEC 7813" || best.Confidence != 1 || len(matches) != 1 {
+			t.Fatalf("parsed %q, %q as %s with confidence %.1f, %d matches",
+				text1, text2, best.Format, best.Confidence, len(matches))
+		}
+		if _, ok := best.Informer.(*IEC7813Tracks); !ok {
+			t.Fatalf("parsed %T", best.Informer)
+		}
+
+		text1, _ = randAAMVATrack1(r, 2+r.Intn(30)).MarshalText()
+		text2, _ = randAAMVATrack2(r, 1+r.Intn(17), "").MarshalText()
+		text3, _ := randAAMVATrack3(r).MarshalText()
+		best, _, err = Parse(string(text1), string(text2), string(text3))
+		if err != nil {
+			t.Fatalf("parsing %q, %q, %q: %v", text1, text2, text3, err)
+		}
+		if _, ok := best.Informer.(*AAMVATracks); !ok || best.Format != "AAMVA DL" {
+			t.Fatalf("parsed %q, %q, %q as %s", text1, text2, text3, best.Format)
+		}
+	}
+}
+
+func TestParseNoFormat(t *testing.T) {
+	if _, _, err := Parse("", "", ""); !errors.Is(err, ErrNoFormat) {
+		t.Errorf("parsed empty tracks: %v", err)
+	}
+	if _, _, err := Parse("%garbage?", ";garbage?", ""); !errors.Is(err, ErrNoFormat) {
+		t.Errorf("parsed garbage: %v", err)
+	}
+}
+
+// testInfo is the Informer of the test format.
+type testInfo string
+
+func (s testInfo) Info() *Info { return &Info{name: "Test", value: string(s)} }
+
+func TestRegister(t *testing.T) {
+	Register(Format{
+		Name: "test",
+		Parse: func(t1, t2, t3 string) (Informer, float64, error) {
+			if t3 != "test" {
+				return nil, 0, errors.New("not a test card")
+			}
+			return testInfo(t3), 1, nil
+		},
+	})
+	found := false
+	for _, name := range Formats() {
+		found = found || name == "test"
+	}
+	if !found {
+		t.Errorf("test not in %q", Formats())
+	}
+	best, _, err := Parse("", "", "test")
+	if err != nil || best.Format != "test" || best.Informer != testInfo("test") {
+		t.Errorf("parsed %+v, %v", best, err)
+	}
+
+	for _, f := range []Format{{Name: "test", Parse: func(string, string, string) (Informer, float64, error) {
+		return nil, 0, nil
+	}}, {Name: "nil"}} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("registered %q", f.Name)
+				}
+			}()
+			Register(f)
+		}()
+	}
+}
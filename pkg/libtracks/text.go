@@ -0,0 +1,65 @@
+package libtracks
+
+// Tracks marshal to and from the text written on the card,
+// including sentinels, so that parsing the text of a valid track
+// gives back the same track.
+
+func (t *IEC7813Track1) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *IEC7813Track1) UnmarshalText(text []byte) error {
+	p, err := NewIEC7813Track1(string(text))
+	if err == nil {
+		*t = *p
+	}
+	return err
+}
+
+func (t *IEC7813Track2) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *IEC7813Track2) UnmarshalText(text []byte) error {
+	p, err := NewIEC7813Track2(string(text))
+	if err == nil {
+		*t = *p
+	}
+	return err
+}
+
+func (t *AAMVATrack1) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *AAMVATrack1) UnmarshalText(text []byte) error {
+	p, err := NewAAMVATrack1(string(text))
+	if err == nil {
+		*t = *p
+	}
+	return err
+}
+
+func (t *AAMVATrack2) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *AAMVATrack2) UnmarshalText(text []byte) error {
+	p, err := NewAAMVATrack2(string(text))
+	if err == nil {
+		*t = *p
+	}
+	return err
+}
+
+func (t *AAMVATrack3) MarshalText() ([]byte, error) {
+	return []byte(t.String()), nil
+}
+
+func (t *AAMVATrack3) UnmarshalText(text []byte) error {
+	p, err := NewAAMVATrack3(string(text))
+	if err == nil {
+		*t = *p
+	}
+	return err
+}
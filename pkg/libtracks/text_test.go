@@ -0,0 +1,186 @@
+package libtracks
+
+import (
+	"encoding"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	aamvad20 "github.com/egginabucket/openmsr/pkg/libtracks/aamva_d20"
+)
+
+const (
+	digits       = "0123456789"
+	upper        = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	alphanumeric = upper + digits
+)
+
+func randString(r *rand.Rand, chars string, n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[r.Intn(len(chars))]
+	}
+	return string(b)
+}
+
+// randDate returns a date that 2 digit years parse back to.
+func randDate(r *rand.Rand) time.Time {
+	return time.Date(1969+r.Intn(100), time.Month(1+r.Intn(12)), 1+r.Intn(28), 0, 0, 0, 0, time.UTC)
+}
+
+func randExpDate(r *rand.Rand) *time.Time {
+	if r.Intn(4) == 0 {
+		return nil
+	}
+	d := randDate(r)
+	d = time.Date(d.Year(), d.Month(), 1, 0, 0, 0, 0, time.UTC)
+	return &d
+}
+
+func randServiceCode(r *rand.Rand) string {
+	if r.Intn(4) == 0 {
+		return ""
+	}
+	return randString(r, digits, 3)
+}
+
+func randPAN(r *rand.Rand) PAN {
+	n, _ := NewPAN(randString(r, digits, 1+r.Intn(19)))
+	return n
+}
+
+func randIEC7813Track1(r *rand.Rand) *IEC7813Track1 {
+	return &IEC7813Track1{
+		PAN:           randPAN(r),
+		Name:          randString(r, upper+" /", 2+r.Intn(25)),
+		ExpDate:       randExpDate(r),
+		ServiceCode:   randServiceCode(r),
+		Discretionary: randString(r, alphanumeric+" ^", r.Intn(20)),
+	}
+}
+
+func randIEC7813Track2(r *rand.Rand) *IEC7813Track2 {
+	return &IEC7813Track2{
+		PAN:           randPAN(r),
+		ExpDate:       randExpDate(r),
+		ServiceCode:   randServiceCode(r),
+		Discretionary: randString(r, digits+"=", r.Intn(20)),
+	}
+}
+
+// randFields returns 1 or more fields joined by '$', n characters in all.
+func randFields(r *rand.Rand, n int) []string {
+	s := []byte(randString(r, upper+" ", n))
+	for i := 1; i < n-1; i++ {
+		if r.Intn(8) == 0 && s[i-1] != '$' {
+			s[i] = '$'
+		}
+	}
+	return strings.Split(string(s), "$")
+}
+
+func randAAMVATrack1(r *rand.Rand, addressLen int) *AAMVATrack1 {
+	return &AAMVATrack1{
+		StateOrProv: randString(r, upper, 2),
+		City:        randString(r, upper+" ", 2+r.Intn(12)),
+		Name:        randFields(r, 2+r.Intn(34)),
+		Address:     randFields(r, addressLen),
+	}
+}
+
+// randAAMVATrack2 returns a track with an ID of idLen digits,
+// expiring in a random month, or as given by exp if it is 77, 88 or 99.
+func randAAMVATrack2(r *rand.Rand, idLen int, exp string) *AAMVATrack2 {
+	t := &AAMVATrack2{
+		IIN:       digits[r.Intn(10)],
+		ID:        randString(r, digits, idLen),
+		ExpDate:   randDate(r),
+		BirthDate: randDate(r),
+	}
+	switch exp {
+	case expMonthNonExp:
+		t.NonExp = true
+	case expMonthBirth:
+		t.ExpBirthMonth = true
+	case expMonthBirthDay:
+		t.ExpBirthDay = true
+	default:
+		t.ExpDate = time.Date(t.ExpDate.Year(), t.ExpDate.Month(), 1, 0, 0, 0, 0, time.UTC)
+		return t
+	}
+	t.ExpDate = time.Date(t.ExpDate.Year(), 1, 1, 0, 0, 0, 0, time.UTC)
+	return t
+}
+
+var (
+	hairColors = []aamvad20.HairColor{"", aamvad20.HairBlack, aamvad20.HairBrown, aamvad20.HairUnknown}
+	eyeColors  = []aamvad20.EyeColor{"", aamvad20.EyeBlue, aamvad20.EyeHazel, aamvad20.EyeUnknown}
+)
+
+func randAAMVATrack3(r *rand.Rand) *AAMVATrack3 {
+	t := &AAMVATrack3{
+		CDSVersion:    r.Intn(10),
+		JdxVersion:    alphanumeric[r.Intn(len(alphanumeric))],
+		PostalCode:    strings.TrimRight(randString(r, alphanumeric+" ", r.Intn(12)), " "),
+		Class:         randString(r, alphanumeric+" ", 2),
+		Restrictions:  randString(r, alphanumeric+" ", 10),
+		Endorsements:  randString(r, alphanumeric+" ", 4),
+		Sex:           aamvad20.Sex("129"[r.Intn(3)]),
+		HairColor:     hairColors[r.Intn(len(hairColors))],
+		EyeColor:      eyeColors[r.Intn(len(eyeColors))],
+		Discretionary: randString(r, alphanumeric+" ", r.Intn(20)),
+	}
+	if r.Intn(4) > 0 {
+		t.Height = &aamvad20.Height{Feet: r.Intn(10), Inches: r.Intn(12)}
+	}
+	if r.Intn(4) > 0 {
+		t.Weight = 1 + r.Intn(999)
+	}
+	return t
+}
+
+// checkRoundTrip checks that unmarshaling the text of t into a new
+// value of its type gives back t.
+func checkRoundTrip(tb testing.TB, t encoding.TextMarshaler) {
+	tb.Helper()
+	text, err := t.MarshalText()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	got := reflect.New(reflect.TypeOf(t).Elem()).Interface().(encoding.TextUnmarshaler)
+	if err := got.UnmarshalText(text); err != nil {
+		tb.Fatalf("parsing %q: %v", text, err)
+	}
+	if !reflect.DeepEqual(got, t) {
+		tb.Fatalf("parsed %q to %+v, want %+v", text, got, t)
+	}
+}
+
+func TestIEC7813TextRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		checkRoundTrip(t, randIEC7813Track1(r))
+		checkRoundTrip(t, randIEC7813Track2(r))
+	}
+}
+
+func TestAAMVATextRoundTrip(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		checkRoundTrip(t, randAAMVATrack3(r))
+	}
+	for addressLen := 2; addressLen <= 40; addressLen++ {
+		for i := 0; i < 10; i++ {
+			checkRoundTrip(t, randAAMVATrack1(r, addressLen))
+		}
+	}
+	for idLen := 1; idLen <= 18; idLen++ {
+		for _, exp := range []string{"", expMonthNonExp, expMonthBirth, expMonthBirthDay} {
+			for i := 0; i < 10; i++ {
+				checkRoundTrip(t, randAAMVATrack2(r, idLen, exp))
+			}
+		}
+	}
+}
@@ -0,0 +1,196 @@
+package wsbridge
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Minimal RFC 6455 server side, just enough for JSON text messages.
+
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+
+	finBit  = 0x80
+	maskBit = 0x80
+
+	maxMessageLen = 1 << 20
+	acceptGUID    = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+)
+
+var errMessageTooLong = errors.New("wsbridge: message too long")
+
+type conn struct {
+	nc  net.Conn
+	br  *bufio.Reader
+	wMu sync.Mutex
+}
+
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, t := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + acceptGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// upgrade completes the opening handshake, replying with an HTTP error if it is invalid.
+func upgrade(w http.ResponseWriter, r *http.Request) (*conn, error) {
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") ||
+		r.Header.Get("Sec-WebSocket-Version") != "13" || key == "" {
+		http.Error(w, "websocket handshake expected", http.StatusBadRequest)
+		return nil, errors.New("wsbridge.upgrade: bad handshake")
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		http.Error(w, "websocket unsupported", http.StatusInternalServerError)
+		return nil, errors.New("wsbridge.upgrade: hijacking unsupported")
+	}
+	nc, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	_, err = rw.WriteString("HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n")
+	if err == nil {
+		err = rw.Flush()
+	}
+	if err != nil {
+		nc.Close()
+		return nil, err
+	}
+	return &conn{nc: nc, br: rw.Reader}, nil
+}
+
+func (c *conn) writeFrame(op byte, payload []byte) error {
+	c.wMu.Lock()
+	defer c.wMu.Unlock()
+	hdr := make([]byte, 2, 10)
+	hdr[0] = finBit | op
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if _, err := c.nc.Write(append(hdr, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+func (c *conn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(c.br, hdr[:]); err != nil {
+		return
+	}
+	fin, op = hdr[0]&finBit != 0, hdr[0]&0x0F
+	if hdr[1]&maskBit == 0 {
+		err = errors.New("wsbridge.conn.readFrame: unmasked client frame")
+		return
+	}
+	n := uint64(hdr[1] &^ maskBit)
+	switch n {
+	case 126:
+		var b [2]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		if _, err = io.ReadFull(c.br, b[:]); err != nil {
+			return
+		}
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if n > maxMessageLen {
+		err = errMessageTooLong
+		return
+	}
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return
+}
+
+// readMessage returns the next text or binary message,
+// answering pings and close frames along the way.
+// It returns io.EOF once the client closes the connection.
+func (c *conn) readMessage() (op byte, msg []byte, err error) {
+	for {
+		fin, fop, payload, err := c.readFrame()
+		if err != nil {
+			return 0, nil, err
+		}
+		switch fop {
+		case opPing:
+			if err := c.writeFrame(opPong, payload); err != nil {
+				return 0, nil, err
+			}
+			continue
+		case opPong:
+			continue
+		case opClose:
+			c.writeFrame(opClose, payload)
+			return 0, nil, io.EOF
+		case opText, opBinary:
+			op, msg = fop, payload
+		case opContinuation:
+			if len(msg)+len(payload) > maxMessageLen {
+				return 0, nil, errMessageTooLong
+			}
+			msg = append(msg, payload...)
+		default:
+			return 0, nil, errors.New("wsbridge.conn.readMessage: unknown opcode")
+		}
+		if fin {
+			return op, msg, nil
+		}
+	}
+}
+
+func (c *conn) writeText(msg []byte) error {
+	return c.writeFrame(opText, msg)
+}
+
+func (c *conn) Close() error {
+	return c.nc.Close()
+}
@@ -0,0 +1,179 @@
+package wsbridge
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+)
+
+// clientFrame returns a frame as sent by a client, masked unless mask is nil.
+func clientFrame(fin bool, op byte, payload []byte, mask []byte) []byte {
+	b := []byte{op, 0}
+	if fin {
+		b[0] |= finBit
+	}
+	switch n := len(payload); {
+	case n < 126:
+		b[1] = byte(n)
+	case n <= 0xFFFF:
+		b[1] = 126
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b[1] = 127
+		b = binary.BigEndian.AppendUint64(b, uint64(n))
+	}
+	if mask == nil {
+		return append(b, payload...)
+	}
+	b[1] |= maskBit
+	b = append(b, mask...)
+	for i, c := range payload {
+		b = append(b, c^mask[i%4])
+	}
+	return b
+}
+
+// readServerFrame reads an unmasked frame sent by the server.
+func readServerFrame(r io.Reader) (op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	if hdr[0]&finBit == 0 || hdr[1]&maskBit != 0 {
+		return 0, nil, errors.New("fragmented or masked server frame")
+	}
+	n := uint64(hdr[1])
+	switch n {
+	case 126:
+		var b [2]byte
+		_, err = io.ReadFull(r, b[:])
+		n = uint64(binary.BigEndian.Uint16(b[:]))
+	case 127:
+		var b [8]byte
+		_, err = io.ReadFull(r, b[:])
+		n = binary.BigEndian.Uint64(b[:])
+	}
+	if err != nil {
+		return
+	}
+	payload = make([]byte, n)
+	_, err = io.ReadFull(r, payload)
+	return hdr[0] & 0x0F, payload, err
+}
+
+// pipe returns a server side conn and the client end of its connection.
+func pipe(t *testing.T) (*conn, net.Conn) {
+	s, c := net.Pipe()
+	t.Cleanup(func() { s.Close(); c.Close() })
+	return &conn{nc: s, br: bufio.NewReader(s)}, c
+}
+
+// send writes frames to client in the background,
+// as net.Pipe writes wait for the other end to read.
+func send(client net.Conn, frames ...[]byte) {
+	go client.Write(bytes.Join(frames, nil))
+}
+
+var testMask = []byte{0x12, 0x34, 0x56, 0x78}
+
+func TestReadFrameLengths(t *testing.T) {
+	c, client := pipe(t)
+	for _, n := range []int{0, 1, 125, 126, 0xFFFF, 0x10000} {
+		payload := bytes.Repeat([]byte("abcdefg"), n/7+1)[:n]
+		send(client, clientFrame(true, opBinary, payload, testMask))
+		fin, op, got, err := c.readFrame()
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if !fin || op != opBinary || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: read fin %v, op %d, %d bytes", n, fin, op, len(got))
+		}
+	}
+}
+
+func TestReadFrameUnmasked(t *testing.T) {
+	c, client := pipe(t)
+	send(client, clientFrame(true, opText, []byte("hi"), nil))
+	if _, _, _, err := c.readFrame(); err == nil {
+		t.Error("no error for an unmasked frame")
+	}
+}
+
+func TestReadFrameTooLong(t *testing.T) {
+	c, client := pipe(t)
+	hdr := []byte{finBit | opText, maskBit | 127}
+	send(client, binary.BigEndian.AppendUint64(hdr, maxMessageLen+1))
+	if _, _, _, err := c.readFrame(); err != errMessageTooLong {
+		t.Errorf("read a frame too long with error %v", err)
+	}
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	c, client := pipe(t)
+	send(client,
+		clientFrame(false, opText, []byte("hello, "), testMask),
+		clientFrame(true, opPing, []byte("ping"), testMask),
+		clientFrame(false, opContinuation, []byte("wor"), testMask),
+		clientFrame(true, opContinuation, []byte("ld"), testMask),
+	)
+	pong := make(chan []byte, 1)
+	go func() {
+		op, payload, err := readServerFrame(client)
+		if err != nil || op != opPong {
+			payload = nil
+		}
+		pong <- payload
+	}()
+	op, msg, err := c.readMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != opText || string(msg) != "hello, world" {
+		t.Errorf("read op %d, %q", op, msg)
+	}
+	if p := <-pong; string(p) != "ping" {
+		t.Errorf("ping answered with %q", p)
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	c, client := pipe(t)
+	send(client, clientFrame(true, opClose, []byte{0x03, 0xE8}, testMask))
+	reply := make(chan byte, 1)
+	go func() {
+		op, _, _ := readServerFrame(client)
+		reply <- op
+	}()
+	if _, _, err := c.readMessage(); err != io.EOF {
+		t.Errorf("read a close frame with error %v, want io.EOF", err)
+	}
+	if op := <-reply; op != opClose {
+		t.Errorf("close answered with op %d", op)
+	}
+}
+
+func TestWriteFrameLengths(t *testing.T) {
+	c, client := pipe(t)
+	for _, n := range []int{0, 125, 126, 0xFFFF, 0x10000} {
+		payload := bytes.Repeat([]byte{'x'}, n)
+		go c.writeText(payload)
+		op, got, err := readServerFrame(client)
+		if err != nil {
+			t.Fatalf("%d bytes: %v", n, err)
+		}
+		if op != opText || !bytes.Equal(got, payload) {
+			t.Errorf("%d bytes: wrote op %d, %d bytes", n, op, len(got))
+		}
+	}
+}
+
+func TestAcceptKey(t *testing.T) {
+	// From RFC 6455, section 1.3.
+	if k := acceptKey("dGhlIHNhbXBsZSBub25jZQ=="); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Errorf("accept key %q", k)
+	}
+}
@@ -0,0 +1,312 @@
+// Package wsbridge serves an MSR605X to browsers over a local WebSocket.
+//
+// Clients send JSON commands and receive JSON replies and events:
+//
+//	{"id": 1, "cmd": "read"}
+//	{"id": 2, "cmd": "write", "tracks": ["%B4111...?", ";4111...?", ""]}
+//	{"id": 3, "cmd": "erase", "select": [true, true, false]}
+//	{"id": 4, "cmd": "config", "hiCo": true, "bpi": [210, 75, 210], "bpc": [7, 5, 5]}
+//	{"id": 5, "cmd": "status"}
+//
+// Every command gets a reply with the same id, and "ok" or "error".
+// Jobs send "status" events as they progress,
+// and reads send a "swipe" event with the decoded tracks.
+package wsbridge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/egginabucket/openmsr/pkg/libmsr"
+	"github.com/egginabucket/openmsr/pkg/libtracks"
+)
+
+type (
+	request struct {
+		ID     int      `json:"id"`
+		Cmd    string   `json:"cmd"`
+		Tracks []string `json:"tracks,omitempty"`
+		Raw    bool     `json:"raw,omitempty"`
+		Select []bool   `json:"select,omitempty"`
+		HiCo   *bool    `json:"hiCo,omitempty"`
+		BPI    []int    `json:"bpi,omitempty"`
+		BPC    []int    `json:"bpc,omitempty"`
+	}
+	reply struct {
+		ID    int    `json:"id"`
+		OK    bool   `json:"ok"`
+		Error string `json:"error,omitempty"`
+		HiCo  *bool  `json:"hiCo,omitempty"`
+	}
+	statusEvent struct {
+		Event string `json:"event"` // "status"
+		ID    int    `json:"id"`
+		State string `json:"state"`
+	}
+	track struct {
+		Raw      []byte `json:"raw"`
+		Data     string `json:"data"`
+		ParityOK bool   `json:"parityOK"`
+		LRCOK    bool   `json:"lrcOK"`
+	}
+	swipeEvent struct {
+		Event  string   `json:"event"` // "swipe"
+		ID     int      `json:"id"`
+		Tracks [3]track `json:"tracks"`
+		Format string   `json:"format,omitempty"`
+		Info   string   `json:"info,omitempty"`
+	}
+)
+
+// readJob is a libmsr.ReadJob calling onRead once a card is read.
+type readJob struct {
+	libmsr.ReadJob
+	onRead func(raw [3][]byte)
+}
+
+func (j *readJob) Run(d *libmsr.Device) error {
+	if err := j.ReadJob.Run(d); err != nil {
+		return err
+	}
+	j.onRead(j.Tracks)
+	return nil
+}
+
+var errInvalidCommand = errors.New("wsbridge: invalid command")
+
+// Server is an http.Handler upgrading requests to WebSocket connections
+// that control a device.
+// Only one client may be connected at a time.
+type Server struct {
+	// AllowedOrigins lists the Origin headers accepted from clients.
+	AllowedOrigins []string
+	queue          *libmsr.Queue
+	mu             sync.Mutex
+	client         *conn
+}
+
+func (s *Server) originAllowed(origin string) bool {
+	for _, o := range s.AllowedOrigins {
+		if o == origin {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.originAllowed(r.Header.Get("Origin")) {
+		http.Error(w, "origin not allowed", http.StatusForbidden)
+		return
+	}
+	s.mu.Lock()
+	if s.client != nil {
+		s.mu.Unlock()
+		http.Error(w, "another client is in control", http.StatusConflict)
+		return
+	}
+	c, err := upgrade(w, r)
+	if err != nil {
+		s.mu.Unlock()
+		log.Println(err)
+		return
+	}
+	s.client = c
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.client = nil
+		s.mu.Unlock()
+	}()
+	s.serveConn(c)
+}
+
+func (s *Server) send(c *conn, v any) {
+	msg, err := json.Marshal(v)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	if err := c.writeText(msg); err != nil {
+		c.Close()
+	}
+}
+
+func (s *Server) serveConn(c *conn) {
+	defer c.Close()
+	var handles []*libmsr.Handle
+	defer func() {
+		for _, h := range handles {
+			h.Cancel() // jobs queued by a client leave with it
+		}
+	}()
+	for {
+		op, msg, err := c.readMessage()
+		if err != nil {
+			return
+		}
+		if op != opText {
+			continue
+		}
+		var req request
+		if err := json.Unmarshal(msg, &req); err != nil {
+			s.send(c, reply{Error: err.Error()})
+			continue
+		}
+		rep := reply{ID: req.ID}
+		job, err := s.job(c, &req, &rep)
+		if err != nil {
+			rep.Error = err.Error()
+			s.send(c, rep)
+			continue
+		}
+		h := s.queue.Submit(job)
+		handles = append(unfinished(handles), h)
+		go func() {
+			for state := range h.Events() {
+				s.send(c, statusEvent{Event: "status", ID: rep.ID, State: state.String()})
+			}
+			if err := h.Wait(context.Background()); err != nil {
+				rep.Error = err.Error()
+			} else {
+				rep.OK = true
+			}
+			s.send(c, rep)
+		}()
+	}
+}
+
+// unfinished filters out the finished jobs of hs.
+func unfinished(hs []*libmsr.Handle) []*libmsr.Handle {
+	n := 0
+	for _, h := range hs {
+		select {
+		case <-h.Done():
+		default:
+			hs[n] = h
+			n++
+		}
+	}
+	return hs[:n]
+}
+
+// job turns a request into a job, which may send events to c
+// and fill in rep before it is sent.
+func (s *Server) job(c *conn, req *request, rep *reply) (libmsr.Job, error) {
+	switch req.Cmd {
+	case "read":
+		return &readJob{onRead: func(raw [3][]byte) {
+			s.send(c, newSwipeEvent(req.ID, raw))
+		}}, nil
+	case "write":
+		if len(req.Tracks) > 3 {
+			return nil, errInvalidCommand
+		}
+		j := libmsr.WriteJob{Raw: req.Raw}
+		for i, t := range req.Tracks {
+			if t == "" {
+				continue
+			}
+			if req.Raw {
+				raw, err := libmsr.EncodeTrack([]byte(t), libmsr.ISOFormats[i], libmsr.DefaultLeadingZeros.Track(i))
+				if err != nil {
+					return nil, err
+				}
+				j.Tracks[i] = raw
+			} else {
+				j.Tracks[i] = []byte(t)
+			}
+		}
+		return &j, nil
+	case "erase":
+		if len(req.Select) > 3 {
+			return nil, errInvalidCommand
+		}
+		var j libmsr.EraseJob
+		copy(j.Tracks[:], req.Select)
+		return &j, nil
+	case "config":
+		if req.BPI != nil && len(req.BPI) != 3 || req.BPC != nil && len(req.BPC) != 3 {
+			return nil, errInvalidCommand
+		}
+		return libmsr.JobFunc(func(d *libmsr.Device) error {
+			var err error
+			if req.HiCo != nil {
+				if *req.HiCo {
+					err = d.SetHiCo()
+				} else {
+					err = d.SetLoCo()
+				}
+				if err != nil {
+					return err
+				}
+			}
+			if req.BPI != nil {
+				if err = d.SetBitsPerInch(req.BPI[0], req.BPI[1], req.BPI[2]); err != nil {
+					return err
+				}
+			}
+			if req.BPC != nil {
+				err = d.SetBitsPerChar(req.BPC[0], req.BPC[1], req.BPC[2])
+			}
+			return err
+		}), nil
+	case "status":
+		return libmsr.JobFunc(func(d *libmsr.Device) error {
+			if err := d.TestCommunication(); err != nil {
+				return err
+			}
+			hiCo, err := d.IsHiCo()
+			if err != nil {
+				return err
+			}
+			rep.HiCo = &hiCo
+			return nil
+		}), nil
+	}
+	return nil, errInvalidCommand
+}
+
+func newSwipeEvent(id int, raw [3][]byte) *swipeEvent {
+	e := swipeEvent{Event: "swipe", ID: id}
+	for i, r := range raw {
+		chars, parityOK, lrcOK := libmsr.DecodeTrack(r, libmsr.ISOFormats[i])
+		t := track{Raw: r, Data: string(chars), ParityOK: true, LRCOK: lrcOK}
+		for _, ok := range parityOK {
+			t.ParityOK = t.ParityOK && ok
+		}
+		e.Tracks[i] = t
+	}
+	e.Format, e.Info = describe(&e.Tracks)
+	return &e
+}
+
+// describe names the card format of tracks and summarizes them, if recognized.
+func describe(tracks *[3]track) (format, info string) {
+	m, _, err := libtracks.Parse(tracks[0].Data, tracks[1].Data, tracks[2].Data)
+	if err != nil {
+		return "", ""
+	}
+	return m.Format, m.Informer.Info().String()
+}
+
+// Close stops the server's job queue and waits for the running job.
+// It does not close the device.
+func (s *Server) Close() {
+	s.queue.Close()
+	s.queue.Wait()
+}
+
+// NewServer returns a server controlling d,
+// accepting clients from the given origins.
+// No other goroutine should use d until the server is closed.
+func NewServer(d *libmsr.Device, allowedOrigins ...string) *Server {
+	return &Server{
+		AllowedOrigins: allowedOrigins,
+		queue:          libmsr.NewQueue(d),
+	}
+}
@@ -0,0 +1,225 @@
+package wsbridge
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/egginabucket/openmsr/pkg/libmsr"
+)
+
+const testOrigin = "http://localhost:3000"
+
+type testClient struct {
+	t  *testing.T
+	nc net.Conn
+	br *bufio.Reader
+}
+
+func newTestServer(t *testing.T) *httptest.Server {
+	e := libmsr.NewEmulator()
+	s := NewServer(libmsr.NewDevice(e), testOrigin)
+	hs := httptest.NewServer(s)
+	t.Cleanup(func() {
+		hs.Close()
+		s.Close()
+		e.Close()
+	})
+	return hs
+}
+
+// dial opens a connection to hs and sends a handshake from origin,
+// returning the client if the server switched protocols.
+func dial(t *testing.T, hs *httptest.Server, origin string) (*testClient, *http.Response) {
+	t.Helper()
+	nc, err := net.Dial("tcp", hs.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { nc.Close() })
+	nc.SetDeadline(time.Now().Add(5 * time.Second))
+	req := "GET / HTTP/1.1\r\n" +
+		"Host: " + hs.Listener.Addr().String() + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: keep-alive, Upgrade\r\n" +
+		"Sec-WebSocket-Key: dGhlIHNhbXBsZSBub25jZQ==\r\n" +
+		"Sec-WebSocket-Version: 13\r\n" +
+		"Origin: " + origin + "\r\n\r\n"
+	if _, err := nc.Write([]byte(req)); err != nil {
+		t.Fatal(err)
+	}
+	br := bufio.NewReader(nc)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil, resp
+	}
+	if k := resp.Header.Get("Sec-WebSocket-Accept"); k != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("accept key %q", k)
+	}
+	return &testClient{t, nc, br}, resp
+}
+
+func (c *testClient) send(req string) {
+	c.t.Helper()
+	if _, err := c.nc.Write(clientFrame(true, opText, []byte(req), testMask)); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+// next returns the next JSON message from the server.
+func (c *testClient) next() map[string]any {
+	c.t.Helper()
+	op, payload, err := readServerFrame(c.br)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if op != opText {
+		c.t.Fatalf("server sent op %d", op)
+	}
+	var m map[string]any
+	if err := json.Unmarshal(payload, &m); err != nil {
+		c.t.Fatal(err)
+	}
+	return m
+}
+
+// reply returns the reply to request id, and the events sent before it.
+func (c *testClient) reply(id float64) (rep map[string]any, events []map[string]any) {
+	c.t.Helper()
+	for {
+		m := c.next()
+		if _, ok := m["event"]; !ok && m["id"] == id {
+			return m, events
+		}
+		events = append(events, m)
+	}
+}
+
+func TestServerOrigin(t *testing.T) {
+	hs := newTestServer(t)
+	for _, origin := range []string{"", "http://evil.example"} {
+		if _, resp := dial(t, hs, origin); resp.StatusCode != http.StatusForbidden {
+			t.Errorf("origin %q: status %s", origin, resp.Status)
+		}
+	}
+}
+
+func TestServerBadHandshake(t *testing.T) {
+	hs := newTestServer(t)
+	req, _ := http.NewRequest(http.MethodGet, hs.URL, nil)
+	req.Header.Set("Origin", testOrigin)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("status %s", resp.Status)
+	}
+}
+
+func TestServerOneClient(t *testing.T) {
+	hs := newTestServer(t)
+	c, _ := dial(t, hs, testOrigin)
+	if c == nil {
+		t.Fatal("first client refused")
+	}
+	if _, resp := dial(t, hs, testOrigin); resp.StatusCode != http.StatusConflict {
+		t.Errorf("second client: status %s", resp.Status)
+	}
+	c.nc.Write(clientFrame(true, opClose, nil, testMask))
+	readServerFrame(c.br)
+	c.nc.Close()
+	for deadline := time.Now().Add(time.Second); ; time.Sleep(10 * time.Millisecond) {
+		if c, resp := dial(t, hs, testOrigin); c != nil {
+			break
+		} else if time.Now().After(deadline) {
+			t.Fatalf("client after the first left: status %s", resp.Status)
+		}
+	}
+}
+
+func TestServerCommands(t *testing.T) {
+	hs := newTestServer(t)
+	c, _ := dial(t, hs, testOrigin)
+	if c == nil {
+		t.Fatal("client refused")
+	}
+
+	c.send(`{"id": 1, "cmd": "status"}`)
+	rep, events := c.reply(1)
+	if rep["ok"] != true || rep["hiCo"] != true {
+		t.Errorf("status reply %v", rep)
+	}
+	var states []string
+	for _, e := range events {
+		states = append(states, e["state"].(string))
+	}
+	if s := strings.Join(states, ", "); s != "queued, running, done" {
+		t.Errorf("status job states: %s", s)
+	}
+
+	c.send(`{"id": 2, "cmd": "write", "raw": true, "tracks": ["%B4111111111111111^DOE/JOHN^2705101?", ";4111111111111111=2705101?", ""]}`)
+	if rep, _ := c.reply(2); rep["ok"] != true {
+		t.Fatalf("write reply %v", rep)
+	}
+
+	c.send(`{"id": 3, "cmd": "read"}`)
+	rep, events = c.reply(3)
+	if rep["ok"] != true {
+		t.Fatalf("read reply %v", rep)
+	}
+	var swipe map[string]any
+	for _, e := range events {
+		if e["event"] == "swipe" {
+			swipe = e
+		}
+	}
+	if swipe == nil {
+		t.Fatal("no swipe event")
+	}
+	tracks := swipe["tracks"].([]any)
+	if d := tracks[1].(map[string]any)["data"]; d != ";4111111111111111=2705101?" {
+		t.Errorf("read track 2 %q", d)
+	}
+	if swipe["format"] != "ISO/IEC 7813" || swipe["info"] == "" {
+		t.Errorf("swipe described as %q: %q", swipe["format"], swipe["info"])
+	}
+
+	for _, req := range []string{
+		`{"id": 4, "cmd": "launch"}`,
+		`{"id": 4, "cmd": "erase", "select": [true, true, true, true]}`,
+		`{"id": 4, "cmd": "config", "bpi": [210]}`,
+	} {
+		c.send(req)
+		if rep := c.next(); rep["ok"] == true || rep["error"] == nil {
+			t.Errorf("%s: reply %v", req, rep)
+		}
+	}
+}
+
+func TestUnfinished(t *testing.T) {
+	e := libmsr.NewEmulator()
+	defer e.Close()
+	q := libmsr.NewQueue(libmsr.NewDevice(e))
+	defer q.Close()
+	block := make(chan struct{})
+	done := q.Submit(libmsr.JobFunc(func(*libmsr.Device) error { return nil }))
+	done.Wait(context.Background())
+	running := q.Submit(libmsr.JobFunc(func(*libmsr.Device) error { <-block; return nil }))
+	pending := q.Submit(libmsr.JobFunc(func(*libmsr.Device) error { return nil }))
+	hs := unfinished([]*libmsr.Handle{done, running, pending})
+	close(block)
+	if len(hs) != 2 || hs[0] != running || hs[1] != pending {
+		t.Errorf("unfinished jobs %v", hs)
+	}
+}